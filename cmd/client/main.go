@@ -38,6 +38,10 @@ func main() {
 	}
 	// в заголовках запроса указываем кодировку
 	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	// токен из /api/user/token позволяет работать от имени пользователя браузера
+	if token := os.Getenv("SHORTENER_TOKEN"); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
 	// отправляем запрос и получаем ответ
 	response, err := client.Do(request)
 	if err != nil {
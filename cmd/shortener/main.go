@@ -2,15 +2,14 @@ package main
 
 import (
 	"context"
-	"github.com/linarium/shortener/internal/usecase"
 	"log"
-	"net/http"
-
-	"github.com/linarium/shortener/internal/logger"
-	"github.com/linarium/shortener/internal/service"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/linarium/shortener/internal/app"
 	"github.com/linarium/shortener/internal/config"
-	"github.com/linarium/shortener/internal/handlers"
+	"github.com/linarium/shortener/internal/logger"
 )
 
 func main() {
@@ -18,22 +17,29 @@ func main() {
 	if err != nil {
 		log.Fatalf("Ошибка инициализации конфигурации: %v\n", err)
 	}
+	if cfg.PrintConfig {
+		if err := cfg.PrintRedacted(os.Stdout); err != nil {
+			log.Fatalf("Ошибка вывода конфигурации: %v\n", err)
+		}
+		return
+	}
 
 	logger.Initialize()
 	defer logger.Sync()
 
-	storage, err := service.NewStorage(context.Background(), cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	application, err := app.New(ctx, cfg)
 	if err != nil {
-		logger.Sugar.Fatalf("Ошибка при создании хранилища: %v", err)
+		logger.Sugar.Fatalf("Ошибка при создании приложения: %v", err)
 	}
-	defer storage.Close()
-
-	shortener := usecase.NewShortenerService(storage)
-	r := handlers.Router(cfg, shortener)
 
-	logger.Sugar.Infof("Server starting on %s", cfg.ServerAddress)
-
-	if err := http.ListenAndServe(cfg.ServerAddress, r); err != nil {
-		logger.Sugar.Fatalf("Сбой в работе сервера: %v", err)
+	if err := application.Run(ctx); err != nil {
+		logger.Sugar.Errorf("Сервер остановлен с ошибкой: %v", err)
+		logger.Sync()
+		os.Exit(1)
 	}
+
+	logger.Sugar.Info("Server stopped")
 }
@@ -0,0 +1,327 @@
+// Package app собирает компоненты сервиса и управляет их запуском и остановкой.
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/linarium/shortener/internal/config"
+	"github.com/linarium/shortener/internal/grpcserver"
+	"github.com/linarium/shortener/internal/handlers"
+	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/keygen"
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/metrics"
+	"github.com/linarium/shortener/internal/policy"
+	"github.com/linarium/shortener/internal/service"
+	"github.com/linarium/shortener/internal/usecase"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// durableStopTimeout — отдельный срок на закрытие хранилищ, если общий срок
+// остановки уже истёк: иначе файловый журнал не сбрасывается на диск, а
+// блокировка файла не снимается до выхода процесса
+const durableStopTimeout = 5 * time.Second
+
+// component — часть приложения, которую нужно остановить при завершении
+type component struct {
+	name string
+	stop func() error
+	// durable — компонент хранит данные и закрывается даже после истечения
+	// общего срока остановки
+	durable bool
+}
+
+// App владеет компонентами сервиса. Компоненты останавливаются в порядке,
+// обратном созданию: сначала HTTP-сервер перестаёт принимать запросы, затем
+// дорабатывают фоновые очереди и последним закрывается хранилище.
+type App struct {
+	cfg        config.Config
+	server     *http.Server
+	components []component
+	// redirect перенаправляет HTTP-запросы на HTTPS, nil если не настроен
+	redirect *http.Server
+	// grpc обслуживает gRPC API, nil если cfg.GRPCAddress пуст
+	grpc *grpc.Server
+
+	// background — фоновые задачи, живущие до остановки приложения
+	background sync.WaitGroup
+}
+
+// New создаёт все компоненты. При ошибке уже созданные компоненты закрываются.
+func New(ctx context.Context, cfg config.Config) (*App, error) {
+	a := &App{cfg: cfg}
+
+	storage, err := service.NewStorage(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage: %w", err)
+	}
+	a.addDurable("storage", storage.Close)
+
+	clickStore, err := service.NewClickStore(ctx, cfg, storage)
+	if err != nil {
+		a.stopComponents(context.Background())
+		return nil, fmt.Errorf("failed to create click store: %w", err)
+	}
+	clicks := service.NewClickPipeline(clickStore, service.ClickPipelineOptions{
+		QueueSize:     cfg.ClicksQueueSize,
+		BatchSize:     cfg.ClicksBatchSize,
+		FlushInterval: cfg.ClicksFlushInterval,
+	})
+	a.addDurable("click pipeline", clicks.Close)
+	if err := metrics.RegisterClickQueue(clicks); err != nil {
+		logger.Sugar.Warnf("Failed to register click queue metrics: %v", err)
+	}
+
+	apiKeyStore, err := service.NewAPIKeyStore(ctx, cfg, storage)
+	if err != nil {
+		a.stopComponents(context.Background())
+		return nil, fmt.Errorf("failed to create API key store: %w", err)
+	}
+	a.addDurable("api key store", apiKeyStore.Close)
+
+	// Хранилища переходов и ключей выбираются по типу исходного хранилища,
+	// поэтому в обёртку с метриками оно заворачивается только после них
+	if db, ok := storage.(*service.DBStorage); ok {
+		if err := metrics.RegisterDBPool(db.SQLDB()); err != nil {
+			logger.Sugar.Warnf("Failed to register DB pool metrics: %v", err)
+		}
+	}
+	instrumented := metrics.InstrumentStorage(storage)
+
+	deletions := service.NewDeletionQueue(instrumented, service.DeletionQueueOptions{
+		Workers:   cfg.DeleteWorkers,
+		QueueSize: cfg.DeleteQueueSize,
+		BatchSize: cfg.DeleteBatchSize,
+	})
+	a.add("deletion queue", deletions.Close)
+	if err := metrics.RegisterDeletionQueue(deletions); err != nil {
+		logger.Sugar.Warnf("Failed to register deletion queue metrics: %v", err)
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	a.add("background tasks", func() error {
+		stopBackground()
+		a.background.Wait()
+		return nil
+	})
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		service.RunExpirationReaper(backgroundCtx, instrumented, cfg.ReaperInterval)
+	}()
+
+	if len(cfg.SecretKeys()) == 0 {
+		cfg.SecretKey = rand.Text()
+		a.cfg = cfg
+		logger.Sugar.Warn("Secret key is not configured, using a random key: users will be logged out on restart")
+	}
+	if cfg.ClickIPSalt == "" {
+		cfg.ClickIPSalt = rand.Text()
+		a.cfg = cfg
+		logger.Sugar.Warn("Click IP salt is not configured, using a random salt: client IP hashes will change on restart")
+	}
+	keys, err := middleware.NewKeyring(cfg.SecretKeys())
+	if err != nil {
+		a.stopComponents(context.Background())
+		return nil, fmt.Errorf("failed to load secret keys: %w", err)
+	}
+
+	shortKeys, err := keygen.New(cfg.ShortKeyAlphabet, cfg.ShortKeyLength)
+	if err != nil {
+		a.stopComponents(context.Background())
+		return nil, fmt.Errorf("failed to configure short keys: %w", err)
+	}
+
+	var destinations usecase.Policy
+	if cfg.PolicyFile != "" {
+		engine, err := policy.Load(cfg.PolicyFile)
+		if err != nil {
+			a.stopComponents(context.Background())
+			return nil, fmt.Errorf("failed to load policy: %w", err)
+		}
+		logger.Sugar.Infof("Loaded policy from %s: %d rules", cfg.PolicyFile, engine.Len())
+		destinations = engine
+
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			engine.Watch(backgroundCtx)
+		}()
+	}
+
+	if cfg.RateLimitShared && cfg.DatabaseDSN == "" {
+		logger.Sugar.Warn("Shared rate limits require a database, falling back to in-memory limits")
+	}
+	limiter := service.NewRateLimitStore(cfg, storage)
+	a.add("rate limiter", limiter.Close)
+
+	shortener := usecase.NewShortenerService(instrumented, clicks, deletions, usecase.ShortenerOptions{
+		StripTrackingParams: cfg.StripTrackingParams,
+		Policy:              destinations,
+		Keys:                shortKeys,
+		KeyAttempts:         cfg.ShortKeyAttempts,
+	})
+	apiKeys := usecase.NewAPIKeyService(apiKeyStore)
+	a.server = &http.Server{
+		Addr:    cfg.ServerAddress,
+		Handler: handlers.Router(cfg, shortener, keys, apiKeys, limiter),
+	}
+
+	if cfg.EnableHTTPS {
+		tlsConfig, err := loadTLSConfig(cfg)
+		if err != nil {
+			a.stopComponents(context.Background())
+			return nil, err
+		}
+		a.server.TLSConfig = tlsConfig
+
+		if cfg.HTTPRedirectAddress != "" {
+			a.redirect = &http.Server{
+				Addr:    cfg.HTTPRedirectAddress,
+				Handler: redirectToHTTPS(cfg.ServerAddress),
+			}
+		}
+	}
+
+	if cfg.GRPCAddress != "" {
+		var opts []grpc.ServerOption
+		if a.server.TLSConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(a.server.TLSConfig)))
+		}
+		a.grpc = grpcserver.NewServer(cfg, shortener, keys, apiKeys, limiter, opts...)
+	}
+
+	return a, nil
+}
+
+func (a *App) add(name string, stop func() error) {
+	a.components = append(a.components, component{name: name, stop: stop})
+}
+
+// addDurable регистрирует компонент, который закрывается и после истечения
+// срока остановки, с отдельным сроком durableStopTimeout
+func (a *App) addDurable(name string, stop func() error) {
+	a.components = append(a.components, component{name: name, stop: stop, durable: true})
+}
+
+// Run обслуживает запросы до отмены ctx или сбоя сервера, после чего
+// останавливает приложение с ограничением cfg.ShutdownTimeout
+func (a *App) Run(ctx context.Context) error {
+	serveErr := make(chan error, 3)
+	go func() {
+		if a.server.TLSConfig != nil {
+			logger.Sugar.Infof("Server starting on %s (HTTPS)", a.cfg.ServerAddress)
+			serveErr <- a.server.ListenAndServeTLS("", "")
+			return
+		}
+		logger.Sugar.Infof("Server starting on %s", a.cfg.ServerAddress)
+		serveErr <- a.server.ListenAndServe()
+	}()
+	if a.redirect != nil {
+		go func() {
+			logger.Sugar.Infof("HTTPS redirect starting on %s", a.redirect.Addr)
+			serveErr <- a.redirect.ListenAndServe()
+		}()
+	}
+	if a.grpc != nil {
+		listener, err := net.Listen("tcp", a.cfg.GRPCAddress)
+		if err != nil {
+			serveErr <- fmt.Errorf("failed to listen gRPC: %w", err)
+		} else {
+			go func() {
+				logger.Sugar.Infof("gRPC server starting on %s", a.cfg.GRPCAddress)
+				serveErr <- a.grpc.Serve(listener)
+			}()
+		}
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		logger.Sugar.Info("Shutdown signal received")
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			runErr = fmt.Errorf("server failed: %w", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+	defer cancel()
+
+	return errors.Join(runErr, a.Shutdown(shutdownCtx))
+}
+
+// Shutdown дожидается завершения текущих запросов и останавливает компоненты.
+// Компонент, не уложившийся в срок ctx, пропускается.
+func (a *App) Shutdown(ctx context.Context) error {
+	var errs []error
+	if a.redirect != nil {
+		if err := a.redirect.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop redirect server: %w", err))
+		}
+	}
+	if err := a.server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to stop http server: %w", err))
+	}
+	if a.grpc != nil {
+		err := stopWithDeadline(ctx, func() error {
+			a.grpc.GracefulStop()
+			return nil
+		})
+		if err != nil {
+			a.grpc.Stop()
+			errs = append(errs, fmt.Errorf("failed to stop grpc server: %w", err))
+		}
+	}
+
+	errs = append(errs, a.stopComponents(ctx))
+	return errors.Join(errs...)
+}
+
+// stopComponents останавливает компоненты в обратном порядке в пределах ctx.
+// Хранилища закрываются и после истечения срока, каждое со своим сроком.
+func (a *App) stopComponents(ctx context.Context) error {
+	var errs []error
+	for i := len(a.components) - 1; i >= 0; i-- {
+		c := a.components[i]
+		stopCtx := ctx
+		if c.durable && ctx.Err() != nil {
+			var cancel context.CancelFunc
+			stopCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), durableStopTimeout)
+			defer cancel()
+		}
+		if err := stopWithDeadline(stopCtx, c.stop); err != nil {
+			// Брошенная остановка продолжает работать в фоне; её запись в уже
+			// закрытое хранилище завершается ошибкой, а не портит журнал
+			logger.Sugar.Errorf("Failed to stop %s: %v", c.name, err)
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", c.name, err))
+			continue
+		}
+		logger.Sugar.Infof("Stopped %s", c.name)
+	}
+	a.components = nil
+
+	return errors.Join(errs...)
+}
+
+func stopWithDeadline(ctx context.Context, stop func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- stop()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/linarium/shortener/internal/config"
+	"github.com/linarium/shortener/internal/logger"
+)
+
+func TestAppShutdown(t *testing.T) {
+	logger.Initialize()
+
+	cfg := config.Config{
+		ServerAddress:       "localhost:0",
+		BaseURL:             "http://localhost:8080",
+		ReaperInterval:      time.Minute,
+		ClicksQueueSize:     10,
+		ClicksBatchSize:     10,
+		ClicksFlushInterval: time.Second,
+		DeleteWorkers:       1,
+		DeleteQueueSize:     10,
+		DeleteBatchSize:     10,
+		ShutdownTimeout:     time.Second,
+		ShortKeyLength:      8,
+		ShortKeyAlphabet:    "base64url",
+	}
+
+	application, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create app: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- application.Run(ctx)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("app did not stop after context cancellation")
+	}
+
+	if len(application.components) != 0 {
+		t.Errorf("expected all components to be stopped")
+	}
+}
+
+func TestStopComponentsClosesDurableAfterDeadline(t *testing.T) {
+	logger.Initialize()
+
+	var closed bool
+	release := make(chan struct{})
+	defer close(release)
+
+	a := &App{}
+	a.addDurable("storage", func() error {
+		closed = true
+		return nil
+	})
+	a.add("stuck queue", func() error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := a.stopComponents(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the stuck component to miss the deadline, got %v", err)
+	}
+	if !closed {
+		t.Error("expected storage to be closed after the deadline")
+	}
+}
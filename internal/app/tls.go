@@ -0,0 +1,172 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/linarium/shortener/internal/config"
+)
+
+// Параметры самоподписанного сертификата для локального запуска
+const (
+	selfSignedCertFile  = "cert.pem"
+	selfSignedKeyFile   = "key.pem"
+	selfSignedValidity  = 365 * 24 * time.Hour
+	selfSignedMinRemain = 24 * time.Hour
+)
+
+// loadTLSConfig берёт сертификат из настроенных файлов, а если они не заданы —
+// самоподписанный сертификат из cfg.TLSCacheDir, при необходимости создавая его
+func loadTLSConfig(cfg config.Config) (*tls.Config, error) {
+	certFile, keyFile := cfg.TLSCertFile, cfg.TLSKeyFile
+	if certFile == "" {
+		var err error
+		certFile, keyFile, err = ensureSelfSignedCert(cfg.TLSCacheDir, certHosts(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare self-signed certificate: %w", err)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// certHosts собирает имена, на которые выписывается самоподписанный сертификат
+func certHosts(cfg config.Config) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host, _, err := net.SplitHostPort(cfg.ServerAddress); err == nil && host != "" {
+		hosts = append(hosts, host)
+	}
+	if base, err := url.Parse(cfg.BaseURL); err == nil && base.Hostname() != "" {
+		hosts = append(hosts, base.Hostname())
+	}
+	return hosts
+}
+
+// ensureSelfSignedCert возвращает пути к сертификату в dir. Сертификат
+// перевыпускается, если его нет или срок его действия подходит к концу.
+func ensureSelfSignedCert(dir string, hosts []string) (string, string, error) {
+	certFile := filepath.Join(dir, selfSignedCertFile)
+	keyFile := filepath.Join(dir, selfSignedKeyFile)
+
+	if cachedCertValid(certFile, keyFile) {
+		return certFile, keyFile, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+
+	certPEM, keyPEM, err := generateSelfSignedCert(hosts)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return "", "", err
+	}
+
+	return certFile, keyFile, nil
+}
+
+func cachedCertValid(certFile, keyFile string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+
+	return time.Until(cert.NotAfter) > selfSignedMinRemain
+}
+
+func generateSelfSignedCert(hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"shortener"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// redirectToHTTPS перенаправляет запросы на тот же путь по HTTPS,
+// подставляя порт основного сервера
+func redirectToHTTPS(httpsAddress string) http.Handler {
+	_, port, err := net.SplitHostPort(httpsAddress)
+	if err != nil {
+		port = ""
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linarium/shortener/internal/config"
+)
+
+func TestSelfSignedCertIsCached(t *testing.T) {
+	cfg := config.Config{
+		ServerAddress: "localhost:8443",
+		BaseURL:       "https://short.example:8443",
+		TLSCacheDir:   t.TempDir(),
+	}
+
+	if _, err := loadTLSConfig(cfg); err != nil {
+		t.Fatalf("failed to load TLS config: %v", err)
+	}
+	first, err := os.ReadFile(filepath.Join(cfg.TLSCacheDir, selfSignedCertFile))
+	if err != nil {
+		t.Fatalf("certificate was not cached: %v", err)
+	}
+
+	tlsConfig, err := loadTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("failed to reload TLS config: %v", err)
+	}
+	second, _ := os.ReadFile(filepath.Join(cfg.TLSCacheDir, selfSignedCertFile))
+	if !bytes.Equal(first, second) {
+		t.Error("expected cached certificate to be reused")
+	}
+
+	leaf := tlsConfig.Certificates[0].Leaf
+	if leaf == nil || leaf.VerifyHostname("short.example") != nil {
+		t.Error("expected certificate to cover BaseURL host")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"localhost:8443", "https://example.com:8443/abc?x=1"},
+		{":443", "https://example.com/abc?x=1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/abc?x=1", nil)
+		w := httptest.NewRecorder()
+
+		redirectToHTTPS(tt.address).ServeHTTP(w, req)
+
+		if w.Code != http.StatusPermanentRedirect {
+			t.Errorf("%s: expected status %d, got %d", tt.address, http.StatusPermanentRedirect, w.Code)
+		}
+		if got := w.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s: expected Location %q, got %q", tt.address, tt.want, got)
+		}
+	}
+}
@@ -3,77 +3,359 @@ package config
 import (
 	"flag"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/linarium/shortener/internal/keygen"
+	"github.com/linarium/shortener/internal/ratelimit"
 )
 
+// Config — настройки сервиса. Каждое поле может прийти из файла конфигурации
+// (ключ json), флага (flag) и переменной окружения (env). Приоритет источников:
+// файл < флаги < переменные окружения; значения по умолчанию задают флаги.
 type Config struct {
-	ServerAddress   string
-	BaseURL         string
-	FileStoragePath string
-	DatabaseDSN     string
-	SecretKey       string
+	ServerAddress   string `json:"server_address" env:"SERVER_ADDRESS" flag:"a"`
+	BaseURL         string `json:"base_url" env:"BASE_URL" flag:"b"`
+	FileStoragePath string `json:"file_storage_path" env:"FILE_STORAGE_PATH" flag:"f"`
+	DatabaseDSN     string `json:"database_dsn" env:"DATABASE_DSN" flag:"d" secret:"dsn"`
+	// SecretKey — ключи подписи кук через запятую; первый основной,
+	// остальные принимаются для проверки на время ротации
+	SecretKey string `json:"secret_key" env:"SECRET_KEY" flag:"k" secret:"true"`
+	// SecretKeyFile — файл с ключами подписи, по одному на строку, первый основной
+	SecretKeyFile string `json:"secret_key_file" env:"SECRET_KEY_FILE" flag:"secret-key-file"`
+	// JWTTTL — срок действия токенов, выдаваемых /api/user/token
+	JWTTTL time.Duration `json:"jwt_ttl" env:"JWT_TTL" flag:"jwt-ttl"`
+	// Пороги уплотнения файлового хранилища, 0 — не уплотнять автоматически.
+	// Файл переходов уплотняется по FileCompactRecords.
+	FileCompactRecords int   `json:"file_compact_records" env:"FILE_COMPACT_RECORDS" flag:"compact-records"`
+	FileCompactSize    int64 `json:"file_compact_size" env:"FILE_COMPACT_SIZE" flag:"compact-size"`
+	// FileStorageStrict запрещает запуск при повреждённых записях в файлах
+	// хранилища, переходов и ключей доступа
+	FileStorageStrict bool `json:"file_storage_strict" env:"FILE_STORAGE_STRICT" flag:"file-strict"`
+	// FileSync — политика fsync файлов хранилища и переходов: always, interval или none
+	FileSync         string        `json:"file_sync" env:"FILE_SYNC" flag:"file-sync"`
+	FileSyncInterval time.Duration `json:"file_sync_interval" env:"FILE_SYNC_INTERVAL" flag:"file-sync-interval"`
+	// ReaperInterval — период фоновой пометки ссылок с истёкшим сроком
+	ReaperInterval time.Duration `json:"reaper_interval" env:"REAPER_INTERVAL" flag:"reaper-interval"`
+	// Очередь записи переходов: ёмкость, размер пачки и период сброса
+	ClicksQueueSize     int           `json:"clicks_queue_size" env:"CLICKS_QUEUE_SIZE" flag:"clicks-queue-size"`
+	ClicksBatchSize     int           `json:"clicks_batch_size" env:"CLICKS_BATCH_SIZE" flag:"clicks-batch-size"`
+	ClicksFlushInterval time.Duration `json:"clicks_flush_interval" env:"CLICKS_FLUSH_INTERVAL" flag:"clicks-flush-interval"`
+	// ClickIPSalt — ключ HMAC, которым в статистике переходов скрываются адреса
+	// клиентов. Не зависит от ключей подписи кук, чтобы хеши не менялись при их
+	// ротации; если не задан, при каждом запуске выбирается случайный.
+	ClickIPSalt string `json:"click_ip_salt" env:"CLICK_IP_SALT" flag:"click-ip-salt" secret:"true"`
+	// Пул удаления ссылок: число обработчиков, ёмкость очереди и размер пачки
+	DeleteWorkers   int `json:"delete_workers" env:"DELETE_WORKERS" flag:"delete-workers"`
+	DeleteQueueSize int `json:"delete_queue_size" env:"DELETE_QUEUE_SIZE" flag:"delete-queue-size"`
+	DeleteBatchSize int `json:"delete_batch_size" env:"DELETE_BATCH_SIZE" flag:"delete-batch-size"`
+	// ShutdownTimeout ограничивает время корректной остановки сервера
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout"`
+	// EnableHTTPS включает TLS; без TLSCertFile и TLSKeyFile используется
+	// самоподписанный сертификат, сохраняемый в TLSCacheDir
+	EnableHTTPS bool   `json:"enable_https" env:"ENABLE_HTTPS" flag:"s"`
+	TLSCertFile string `json:"tls_cert_file" env:"TLS_CERT_FILE" flag:"tls-cert"`
+	TLSKeyFile  string `json:"tls_key_file" env:"TLS_KEY_FILE" flag:"tls-key"`
+	TLSCacheDir string `json:"tls_cache_dir" env:"TLS_CACHE_DIR" flag:"tls-cache-dir"`
+	// HTTPRedirectAddress — адрес HTTP-сервера, перенаправляющего на HTTPS
+	HTTPRedirectAddress string `json:"http_redirect_address" env:"HTTP_REDIRECT_ADDRESS" flag:"redirect-address"`
+	// TrustedSubnet — CIDR, из которой доступны служебные маршруты /api/internal
+	TrustedSubnet string `json:"trusted_subnet" env:"TRUSTED_SUBNET" flag:"t"`
+	// TrustedProxies — подсети (CIDR) через запятую, от которых принимаются
+	// X-Real-IP и X-Forwarded-For; без них адресом клиента считается адрес соединения
+	TrustedProxies string `json:"trusted_proxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies"`
+	// GRPCAddress — адрес gRPC-сервера, пустой отключает его
+	GRPCAddress string `json:"grpc_address" env:"GRPC_ADDRESS,allowempty" flag:"g"`
+	// StripTrackingParams удаляет из сокращаемых URL параметры utm_*, fbclid и подобные
+	StripTrackingParams bool `json:"strip_tracking_params" env:"STRIP_TRACKING_PARAMS" flag:"strip-tracking"`
+	// Генерация коротких ключей: длина, алфавит (base64url, base62, base58 или
+	// сами символы) и число попыток при совпадении с занятым ключом
+	ShortKeyLength   int    `json:"short_key_length" env:"SHORT_KEY_LENGTH" flag:"key-length"`
+	ShortKeyAlphabet string `json:"short_key_alphabet" env:"SHORT_KEY_ALPHABET" flag:"key-alphabet"`
+	ShortKeyAttempts int    `json:"short_key_attempts" env:"SHORT_KEY_ATTEMPTS" flag:"key-attempts"`
+	// PolicyFile — JSON-файл с правилами разрешённых и запрещённых адресов
+	PolicyFile string `json:"policy_file" env:"POLICY_FILE" flag:"policy-file"`
+	// Лимиты запросов по классам маршрутов в формате "60/m"; пустое значение
+	// или "off" отключает лимит, по умолчанию лимиты выключены
+	RateLimitCreate   string `json:"rate_limit_create" env:"RATE_LIMIT_CREATE" flag:"rate-limit-create"`
+	RateLimitBatch    string `json:"rate_limit_batch" env:"RATE_LIMIT_BATCH" flag:"rate-limit-batch"`
+	RateLimitRedirect string `json:"rate_limit_redirect" env:"RATE_LIMIT_REDIRECT" flag:"rate-limit-redirect"`
+	RateLimitDelete   string `json:"rate_limit_delete" env:"RATE_LIMIT_DELETE" flag:"rate-limit-delete"`
+	// RateLimitShared хранит счётчики лимитов в Postgres, чтобы экземпляры
+	// сервиса делили их между собой; без DatabaseDSN игнорируется
+	RateLimitShared bool `json:"rate_limit_shared" env:"RATE_LIMIT_SHARED" flag:"rate-limit-shared"`
+
+	// ConfigFile — путь до JSON-файла конфигурации
+	ConfigFile string `json:"-" env:"CONFIG" flag:"c"`
+	// PrintConfig — вывести итоговые настройки и завершиться
+	PrintConfig bool `json:"-"`
 }
 
 func InitConfig() (Config, error) {
-	cfg := Config{}
-
-	// Получаем значения из переменных окружения
-	serverAddress := os.Getenv("SERVER_ADDRESS")
-	baseURL := os.Getenv("BASE_URL")
-	fileStoragePath := os.Getenv("FILE_STORAGE_PATH")
-	databaseDSN := os.Getenv("DATABASE_DSN")
+	return load(flag.CommandLine, os.Args[1:], os.LookupEnv)
+}
 
-	flag.StringVar(&cfg.ServerAddress, "a", "localhost:8080", "Адрес запуска HTTP-сервера")
-	flag.StringVar(&cfg.BaseURL, "b", "http://localhost:8080", "Базовый адрес для сокращённого URL")
-	flag.StringVar(&cfg.FileStoragePath, "f", "/tmp/shortener.json", "Путь до файла для сохранения данных")
-	flag.StringVar(&cfg.DatabaseDSN, "d", "", "Database DSN")
-	flag.Parse()
+// load собирает конфигурацию из файла, флагов args и окружения lookupEnv
+func load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Config{}
+	defineFlags(fs, &cfg)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
 
-	// Приоритет: переменные окружения > флаги > значения по умолчанию
-	if serverAddress != "" {
-		cfg.ServerAddress = serverAddress
+	sources := flagSources(fs)
+	if path, ok := lookupEnv("CONFIG"); ok && path != "" {
+		cfg.ConfigFile = path
 	}
-	if baseURL != "" {
-		cfg.BaseURL = baseURL
+	if cfg.ConfigFile != "" {
+		explicit := make(map[string]struct{})
+		fs.Visit(func(f *flag.Flag) {
+			explicit[f.Name] = struct{}{}
+		})
+		if err := applyFile(&cfg, cfg.ConfigFile, explicit, sources); err != nil {
+			return Config{}, err
+		}
 	}
-	if fileStoragePath != "" {
-		cfg.FileStoragePath = fileStoragePath
+
+	if err := applyEnv(&cfg, lookupEnv, sources); err != nil {
+		return Config{}, err
 	}
-	if databaseDSN != "" {
-		cfg.DatabaseDSN = databaseDSN
+
+	if cfg.SecretKeyFile != "" {
+		if cfg.SecretKey != "" {
+			return Config{}, sources.invalid([]string{"SecretKey", "SecretKeyFile"}, "SecretKey и SecretKeyFile не задаются одновременно")
+		}
+		keys, err := readSecretKeyFile(cfg.SecretKeyFile)
+		if err != nil {
+			return Config{}, sources.invalid([]string{"SecretKeyFile"}, "%v", err)
+		}
+		cfg.SecretKey = strings.Join(keys, ",")
+		sources["SecretKey"] = "файл ключей " + cfg.SecretKeyFile
 	}
 
-	if err := validateConfig(cfg); err != nil {
+	if err := validateConfig(cfg, sources); err != nil {
 		return Config{}, err
 	}
 
 	return cfg, nil
 }
 
-func validateConfig(cfg Config) error {
+func defineFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.ServerAddress, "a", "localhost:8080", "Адрес запуска HTTP-сервера")
+	fs.StringVar(&cfg.BaseURL, "b", "http://localhost:8080", "Базовый адрес для сокращённого URL")
+	fs.StringVar(&cfg.FileStoragePath, "f", "/tmp/shortener.json", "Путь до файла для сохранения данных")
+	fs.StringVar(&cfg.DatabaseDSN, "d", "", "Database DSN")
+	fs.StringVar(&cfg.SecretKey, "k", "", "Ключи подписи кук через запятую, первый основной")
+	fs.StringVar(&cfg.SecretKeyFile, "secret-key-file", "", "Файл с ключами подписи кук, по одному на строку")
+	fs.DurationVar(&cfg.JWTTTL, "jwt-ttl", 24*time.Hour, "Срок действия токенов для API-клиентов")
+	fs.IntVar(&cfg.FileCompactRecords, "compact-records", 10000, "Число устаревших записей в файле хранилища до уплотнения")
+	fs.Int64Var(&cfg.FileCompactSize, "compact-size", 64<<20, "Прирост файла хранилища в байтах до уплотнения")
+	fs.BoolVar(&cfg.FileStorageStrict, "file-strict", false, "Не запускаться при повреждённых записях в файле хранилища")
+	fs.StringVar(&cfg.FileSync, "file-sync", "interval", "Политика fsync файла хранилища: always, interval или none")
+	fs.DurationVar(&cfg.FileSyncInterval, "file-sync-interval", time.Second, "Период fsync файла хранилища для политики interval")
+	fs.DurationVar(&cfg.ReaperInterval, "reaper-interval", time.Minute, "Период пометки ссылок с истёкшим сроком действия")
+	fs.IntVar(&cfg.ClicksQueueSize, "clicks-queue-size", 10000, "Ёмкость очереди записи переходов")
+	fs.IntVar(&cfg.ClicksBatchSize, "clicks-batch-size", 500, "Размер пачки переходов для записи в хранилище")
+	fs.DurationVar(&cfg.ClicksFlushInterval, "clicks-flush-interval", time.Second, "Период сброса неполной пачки переходов")
+	fs.StringVar(&cfg.ClickIPSalt, "click-ip-salt", "", "Ключ хеширования адресов клиентов в статистике переходов")
+	fs.IntVar(&cfg.DeleteWorkers, "delete-workers", 4, "Число обработчиков удаления ссылок")
+	fs.IntVar(&cfg.DeleteQueueSize, "delete-queue-size", 1000, "Ёмкость очереди удаления ссылок")
+	fs.IntVar(&cfg.DeleteBatchSize, "delete-batch-size", 500, "Сколько ссылок удаляется одним запросом к хранилищу")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "Время на корректную остановку сервера")
+	fs.BoolVar(&cfg.EnableHTTPS, "s", false, "Запускать сервер по HTTPS")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", "", "Путь до файла сертификата TLS")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", "", "Путь до файла закрытого ключа TLS")
+	fs.StringVar(&cfg.TLSCacheDir, "tls-cache-dir", filepath.Join(os.TempDir(), "shortener-tls"), "Каталог для самоподписанного сертификата")
+	fs.StringVar(&cfg.HTTPRedirectAddress, "redirect-address", "", "Адрес HTTP-сервера, перенаправляющего на HTTPS")
+	fs.StringVar(&cfg.TrustedSubnet, "t", "", "Доверенная подсеть (CIDR) для служебных маршрутов")
+	fs.StringVar(&cfg.TrustedProxies, "trusted-proxies", "", "Подсети (CIDR) прокси, которым можно доверять X-Forwarded-For")
+	fs.StringVar(&cfg.GRPCAddress, "g", "", "Адрес gRPC-сервера, например localhost:3200; пустой отключает его")
+	fs.BoolVar(&cfg.StripTrackingParams, "strip-tracking", false, "Удалять из URL параметры отслеживания")
+	fs.IntVar(&cfg.ShortKeyLength, "key-length", 8, "Длина генерируемых коротких ключей")
+	fs.StringVar(&cfg.ShortKeyAlphabet, "key-alphabet", "base64url", "Алфавит коротких ключей: base64url, base62, base58 или набор символов")
+	fs.IntVar(&cfg.ShortKeyAttempts, "key-attempts", 5, "Число попыток сгенерировать незанятый короткий ключ")
+	fs.StringVar(&cfg.PolicyFile, "policy-file", "", "Файл правил разрешённых и запрещённых адресов")
+	fs.StringVar(&cfg.RateLimitCreate, "rate-limit-create", "", "Лимит создания ссылок на пользователя и IP, например 60/m; пустой отключает")
+	fs.StringVar(&cfg.RateLimitBatch, "rate-limit-batch", "", "Лимит пакетного создания ссылок на пользователя и IP, например 10/m; пустой отключает")
+	fs.StringVar(&cfg.RateLimitRedirect, "rate-limit-redirect", "", "Лимит переходов по ссылкам на пользователя и IP, например 1200/m; пустой отключает")
+	fs.StringVar(&cfg.RateLimitDelete, "rate-limit-delete", "", "Лимит запросов на удаление на пользователя и IP, например 30/m; пустой отключает")
+	fs.BoolVar(&cfg.RateLimitShared, "rate-limit-shared", false, "Хранить счётчики лимитов в Postgres")
+	fs.StringVar(&cfg.ConfigFile, "c", "", "Путь до JSON-файла конфигурации")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "Вывести итоговую конфигурацию без секретов и завершиться")
+}
+
+// validateConfig проверяет итоговые значения; ошибки называют источник
+// каждого поля из sources
+func validateConfig(cfg Config, sources valueSources) error {
 	if cfg.ServerAddress == "" {
-		return fmt.Errorf("ServerAddress не может быть пустым")
+		return sources.invalid([]string{"ServerAddress"}, "ServerAddress не может быть пустым")
 	}
 
 	if cfg.BaseURL == "" {
-		return fmt.Errorf("BaseURL не может быть пустым")
+		return sources.invalid([]string{"BaseURL"}, "BaseURL не может быть пустым")
 	}
 	if _, err := url.ParseRequestURI(cfg.BaseURL); err != nil {
-		return fmt.Errorf("BaseURL должен быть корректным URL: %v", err)
+		return sources.invalid([]string{"BaseURL"}, "BaseURL должен быть корректным URL: %v", err)
 	}
 
 	if cfg.FileStoragePath == "" {
-		return fmt.Errorf("FileStoragePath не может быть пустым")
+		return sources.invalid([]string{"FileStoragePath"}, "FileStoragePath не может быть пустым")
 	}
 	if !filepath.IsAbs(cfg.FileStoragePath) {
-		return fmt.Errorf("FileStoragePath должен быть абсолютным путём")
+		return sources.invalid([]string{"FileStoragePath"}, "FileStoragePath должен быть абсолютным путём")
+	}
+	if cfg.FileCompactRecords < 0 || cfg.FileCompactSize < 0 {
+		return sources.invalid([]string{"FileCompactRecords", "FileCompactSize"}, "пороги уплотнения не могут быть отрицательными")
+	}
+	if cfg.ReaperInterval <= 0 {
+		return sources.invalid([]string{"ReaperInterval"}, "ReaperInterval должен быть положительным")
+	}
+	if cfg.ClicksQueueSize <= 0 || cfg.ClicksBatchSize <= 0 || cfg.ClicksFlushInterval <= 0 {
+		return sources.invalid([]string{"ClicksQueueSize", "ClicksBatchSize", "ClicksFlushInterval"}, "параметры очереди переходов должны быть положительными")
+	}
+	if cfg.DeleteWorkers <= 0 || cfg.DeleteQueueSize <= 0 || cfg.DeleteBatchSize <= 0 {
+		return sources.invalid([]string{"DeleteWorkers", "DeleteQueueSize", "DeleteBatchSize"}, "параметры очереди удаления должны быть положительными")
+	}
+	if cfg.JWTTTL <= 0 {
+		return sources.invalid([]string{"JWTTTL"}, "JWTTTL должен быть положительным")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return sources.invalid([]string{"ShutdownTimeout"}, "ShutdownTimeout должен быть положительным")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return sources.invalid([]string{"TLSCertFile", "TLSKeyFile"}, "TLSCertFile и TLSKeyFile задаются только вместе")
+	}
+	if cfg.EnableHTTPS && cfg.TLSCertFile == "" && cfg.TLSCacheDir == "" {
+		return sources.invalid([]string{"TLSCacheDir", "TLSCertFile"}, "TLSCacheDir не может быть пустым без TLSCertFile")
+	}
+	if cfg.HTTPRedirectAddress != "" && !cfg.EnableHTTPS {
+		return sources.invalid([]string{"HTTPRedirectAddress", "EnableHTTPS"}, "HTTPRedirectAddress требует EnableHTTPS")
+	}
+	if cfg.TrustedSubnet != "" {
+		if _, _, err := net.ParseCIDR(cfg.TrustedSubnet); err != nil {
+			return sources.invalid([]string{"TrustedSubnet"}, "TrustedSubnet должна быть подсетью в формате CIDR: %v", err)
+		}
+	}
+	if _, err := parseCIDRs(cfg.TrustedProxies); err != nil {
+		return sources.invalid([]string{"TrustedProxies"}, "TrustedProxies должны быть подсетями в формате CIDR: %v", err)
+	}
+	if _, err := keygen.New(cfg.ShortKeyAlphabet, cfg.ShortKeyLength); err != nil {
+		return sources.invalid([]string{"ShortKeyAlphabet", "ShortKeyLength"}, "параметры коротких ключей заданы неверно: %v", err)
+	}
+	if cfg.ShortKeyAttempts <= 0 {
+		return sources.invalid([]string{"ShortKeyAttempts"}, "ShortKeyAttempts должен быть положительным")
+	}
+	for class, spec := range cfg.rateLimitSpecs() {
+		if _, err := ratelimit.ParseLimit(spec); err != nil {
+			return sources.invalid([]string{rateLimitFields[class]}, "лимит запросов %s задан неверно: %v", class, err)
+		}
+	}
+	switch cfg.FileSync {
+	case "", "always", "interval", "none":
+	default:
+		return sources.invalid([]string{"FileSync"}, "FileSync должен быть always, interval или none")
 	}
 
 	return nil
 }
 
+// SecretKeys возвращает ключи подписи, основной ключ первым
+func (c Config) SecretKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(c.SecretKey, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// PrimarySecretKey возвращает основной ключ подписи
+func (c Config) PrimarySecretKey() string {
+	if keys := c.SecretKeys(); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// TrustedProxyNets возвращает подсети доверенных прокси
+func (c Config) TrustedProxyNets() []*net.IPNet {
+	// Формат проверен в validateConfig
+	nets, _ := parseCIDRs(c.TrustedProxies)
+	return nets
+}
+
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range strings.Split(list, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, subnet)
+	}
+	return nets, nil
+}
+
+// RateLimits возвращает лимиты запросов по классам маршрутов
+func (c Config) RateLimits() map[string]ratelimit.Limit {
+	limits := make(map[string]ratelimit.Limit)
+	for class, spec := range c.rateLimitSpecs() {
+		// Формат проверен в validateConfig
+		limits[class], _ = ratelimit.ParseLimit(spec)
+	}
+	return limits
+}
+
+// rateLimitFields — поля Config с лимитами по классам маршрутов
+var rateLimitFields = map[string]string{
+	ratelimit.ClassCreate:   "RateLimitCreate",
+	ratelimit.ClassBatch:    "RateLimitBatch",
+	ratelimit.ClassRedirect: "RateLimitRedirect",
+	ratelimit.ClassDelete:   "RateLimitDelete",
+}
+
+func (c Config) rateLimitSpecs() map[string]string {
+	return map[string]string{
+		ratelimit.ClassCreate:   c.RateLimitCreate,
+		ratelimit.ClassBatch:    c.RateLimitBatch,
+		ratelimit.ClassRedirect: c.RateLimitRedirect,
+		ratelimit.ClassDelete:   c.RateLimitDelete,
+	}
+}
+
+// readSecretKeyFile читает ключи из файла, пропуская пустые строки и комментарии
+func readSecretKeyFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("файл ключей %s: %w", path, err)
+	}
+
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, ",") {
+			return nil, fmt.Errorf("файл ключей %s: ключ не может содержать запятую", path)
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("файл ключей %s: не найдено ни одного ключа", path)
+	}
+
+	return keys, nil
+}
+
 // String возвращает строковое представление конфигурации
 func (c *Config) String() string {
 	return fmt.Sprintf("ServerAddress: %s, BaseURL: %s", c.ServerAddress, c.BaseURL)
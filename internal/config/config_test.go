@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"server_address": "file:1",
+		"base_url": "http://file:1",
+		"reaper_interval": "5m",
+		"delete_workers": 7
+	}`)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := load(fs, []string{"-c", path, "-b", "http://flag:2", "-a", "flag:2"}, envFrom(map[string]string{
+		"SERVER_ADDRESS": "env:3",
+	}))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	if cfg.ServerAddress != "env:3" {
+		t.Errorf("expected env to override flag, got %q", cfg.ServerAddress)
+	}
+	if cfg.BaseURL != "http://flag:2" {
+		t.Errorf("expected flag to override file, got %q", cfg.BaseURL)
+	}
+	if cfg.ReaperInterval != 5*time.Minute || cfg.DeleteWorkers != 7 {
+		t.Errorf("expected file values over defaults, got %v and %d", cfg.ReaperInterval, cfg.DeleteWorkers)
+	}
+	if cfg.DeleteQueueSize != 1000 {
+		t.Errorf("expected default for unset value, got %d", cfg.DeleteQueueSize)
+	}
+}
+
+func TestLoadErrorsNameSource(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "bad file value",
+			file: `{"delete_workers": "many"}`,
+			want: "параметр delete_workers",
+		},
+		{
+			name: "unknown file key",
+			file: `{"delete_workerz": 1}`,
+			want: `неизвестный параметр "delete_workerz"`,
+		},
+		{
+			name: "bad env value",
+			file: `{}`,
+			env:  map[string]string{"SHUTDOWN_TIMEOUT": "soon"},
+			want: "переменная окружения SHUTDOWN_TIMEOUT",
+		},
+		{
+			name: "invalid file value",
+			file: `{"trusted_subnet": "10.0.0.0"}`,
+			want: "TrustedSubnet — файл конфигурации",
+		},
+		{
+			name: "invalid flag value",
+			file: `{}`,
+			args: []string{"-t", "10.0.0.0"},
+			want: "TrustedSubnet — флаг -t",
+		},
+		{
+			name: "invalid env value",
+			file: `{"trusted_subnet": "10.0.0.0/8"}`,
+			env:  map[string]string{"TRUSTED_SUBNET": "10.0.0.0"},
+			want: "TrustedSubnet — переменная окружения TRUSTED_SUBNET",
+		},
+		{
+			name: "invalid default combination",
+			file: `{"tls_cert_file": "/tmp/cert.pem"}`,
+			want: "TLSKeyFile — значение по умолчанию",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.file)
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			_, err := load(fs, append([]string{"-c", path}, tt.args...), envFrom(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPrintRedacted(t *testing.T) {
+	cfg := Config{
+		DatabaseDSN:     "host=db user=app password=hunter2 dbname=shortener",
+		SecretKey:       "top-secret",
+		ClickIPSalt:     "ip-salt",
+		ShutdownTimeout: 10 * time.Second,
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.PrintRedacted(&buf); err != nil {
+		t.Fatalf("PrintRedacted failed: %v", err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "top-secret") || strings.Contains(out, "ip-salt") {
+		t.Errorf("expected secrets to be redacted, got %s", out)
+	}
+	if !strings.Contains(out, `"shutdown_timeout": "10s"`) {
+		t.Errorf("expected durations in file format, got %s", out)
+	}
+}
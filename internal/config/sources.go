@@ -0,0 +1,245 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redacted заменяет значения секретов при выводе конфигурации
+const redacted = "[REDACTED]"
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	// dsnPassword находит пароль в DSN вида "key=value"
+	dsnPassword = regexp.MustCompile(`password=\S+`)
+)
+
+// valueSources хранит для полей Config, откуда пришло итоговое значение,
+// чтобы ошибки проверки называли источник
+type valueSources map[string]string
+
+// defaultSource — источник значений, не заданных ни одним способом
+const defaultSource = "значение по умолчанию"
+
+// flagSources отмечает поля, явно заданные флагами из fs
+func flagSources(fs *flag.FlagSet) valueSources {
+	byFlag := make(map[string]string)
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(Config{})) {
+		if name := field.Tag.Get("flag"); name != "" {
+			byFlag[name] = field.Name
+		}
+	}
+
+	sources := make(valueSources)
+	fs.Visit(func(f *flag.Flag) {
+		if field, ok := byFlag[f.Name]; ok {
+			sources[field] = "флаг -" + f.Name
+		}
+	})
+	return sources
+}
+
+func (s valueSources) of(field string) string {
+	if source, ok := s[field]; ok {
+		return source
+	}
+	return defaultSource
+}
+
+// invalid формирует ошибку проверки и дописывает к ней источники полей fields
+func (s valueSources) invalid(fields []string, format string, args ...any) error {
+	origins := make([]string, len(fields))
+	for i, field := range fields {
+		origins[i] = field + " — " + s.of(field)
+	}
+	return fmt.Errorf("%s (источник: %s)", fmt.Sprintf(format, args...), strings.Join(origins, "; "))
+}
+
+// applyFile применяет значения из JSON-файла path. Параметры, явно заданные
+// флагами из explicit, не перезаписываются.
+func applyFile(cfg *Config, path string, explicit map[string]struct{}, sources valueSources) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("файл конфигурации %s: %w", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("файл конфигурации %s: некорректный JSON: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := fieldsByJSONKey()
+	target := reflect.ValueOf(cfg).Elem()
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("файл конфигурации %s: неизвестный параметр %q", path, key)
+		}
+		if _, set := explicit[field.Tag.Get("flag")]; set {
+			continue
+		}
+
+		var value string
+		switch raw := values[key].(type) {
+		case string:
+			value = raw
+		case json.Number:
+			value = raw.String()
+		case bool:
+			value = strconv.FormatBool(raw)
+		default:
+			return fmt.Errorf("файл конфигурации %s: параметр %s: ожидается строка, число или логическое значение", path, key)
+		}
+
+		if err := setField(target.FieldByIndex(field.Index), value); err != nil {
+			return fmt.Errorf("файл конфигурации %s: параметр %s: %w", path, key, err)
+		}
+		sources[field.Name] = "файл конфигурации " + path
+	}
+
+	return nil
+}
+
+// applyEnv применяет непустые переменные окружения; пустое значение
+// учитывается только для тегов с опцией allowempty
+func applyEnv(cfg *Config, lookupEnv func(string) (string, bool), sources valueSources) error {
+	target := reflect.ValueOf(cfg).Elem()
+	for _, field := range reflect.VisibleFields(target.Type()) {
+		tag := field.Tag.Get("env")
+		if tag == "" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		value, ok := lookupEnv(name)
+		if !ok || value == "" && options != "allowempty" {
+			continue
+		}
+		if err := setField(target.FieldByIndex(field.Index), value); err != nil {
+			return fmt.Errorf("переменная окружения %s: %w", name, err)
+		}
+		sources[field.Name] = "переменная окружения " + name
+	}
+	return nil
+}
+
+func fieldsByJSONKey() map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(Config{})) {
+		if key := jsonKey(field); key != "" {
+			fields[key] = field
+		}
+	}
+	return fields
+}
+
+func jsonKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("ожидается длительность, например 1s: %q", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ожидается логическое значение: %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("ожидается целое число: %q", value)
+		}
+		field.SetInt(n)
+	default:
+		return errors.New("неподдерживаемый тип параметра")
+	}
+	return nil
+}
+
+// PrintRedacted выводит итоговую конфигурацию в формате файла конфигурации,
+// заменяя секреты
+func (c Config) PrintRedacted(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+
+	source := reflect.ValueOf(c)
+	fields := reflect.VisibleFields(source.Type())
+	first := true
+	for _, field := range fields {
+		key := jsonKey(field)
+		if key == "" {
+			continue
+		}
+
+		var value any = source.FieldByIndex(field.Index).Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		switch field.Tag.Get("secret") {
+		case "true":
+			if value != "" {
+				value = redacted
+			}
+		case "dsn":
+			value = redactDSN(value.(string))
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if !first {
+			buf.WriteString(",\n")
+		}
+		first = false
+		fmt.Fprintf(&buf, "  %q: %s", key, encoded)
+	}
+
+	buf.WriteString("\n}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// redactDSN скрывает пароль в DSN в форме URL или "key=value"
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "password="+redacted)
+}
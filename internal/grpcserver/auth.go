@@ -0,0 +1,81 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UserIDMetadataKey — ключ метаданных с подписанным идентификатором пользователя
+const UserIDMetadataKey = "user-id"
+
+// AuthInterceptor — аналог middleware.Authenticate для gRPC. Токен берётся из
+// метаданных user-id; если его нет или подпись неверна, создаётся новый
+// пользователь, а его токен отправляется клиенту в заголовке ответа.
+// Токен, подписанный неосновным ключом, выпускается заново. JWT из
+// метаданных authorization и ключ доступа из x-api-key принимаются так же,
+// как в HTTP API.
+func AuthInterceptor(keys *middleware.Keyring, apiKeys middleware.APIKeyResolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if key := metadataValue(ctx, "x-api-key"); key != "" && apiKeys != nil {
+			userID, found, err := apiKeys.ResolveAPIKey(ctx, key)
+			if err != nil {
+				logger.FromContext(ctx).Errorf("Failed to resolve API key: %v", err)
+				return nil, status.Error(codes.Internal, "failed to resolve API key")
+			}
+			if !found {
+				return nil, status.Error(codes.Unauthenticated, "invalid API key")
+			}
+			return handler(middleware.WithUserID(ctx, userID), req)
+		}
+
+		if header := metadataValue(ctx, "authorization"); header != "" {
+			token, ok := middleware.BearerToken(header)
+			if !ok {
+				return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+			}
+			userID, err := middleware.ParseJWT(token, keys)
+			if err != nil {
+				return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+			}
+			return handler(middleware.WithUserID(ctx, userID), req)
+		}
+
+		userID, stale, err := middleware.ParseUserToken(metadataValue(ctx, UserIDMetadataKey), keys)
+		switch {
+		case err != nil:
+			var token string
+			userID, token = middleware.NewUserToken(keys)
+			sendUserToken(ctx, token)
+			logger.FromContext(ctx).Debugf("Created new gRPC user ID: %s", userID)
+		case stale:
+			sendUserToken(ctx, middleware.IssueUserToken(userID, keys))
+			logger.FromContext(ctx).Debugf("Re-issued gRPC token for user ID: %s", userID)
+		}
+
+		return handler(middleware.WithUserID(ctx, userID), req)
+	}
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func sendUserToken(ctx context.Context, token string) {
+	if err := grpc.SetHeader(ctx, metadata.Pairs(UserIDMetadataKey, token)); err != nil {
+		logger.FromContext(ctx).Errorf("Failed to send user token: %v", err)
+	}
+}
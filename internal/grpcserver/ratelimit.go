@@ -0,0 +1,78 @@
+package grpcserver
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+
+	"github.com/linarium/shortener/internal/grpcserver/pb"
+	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/metrics"
+	"github.com/linarium/shortener/internal/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RetryAfterMetadataKey — заголовок ответа с числом секунд до следующей попытки
+const RetryAfterMetadataKey = "retry-after"
+
+// methodClasses сопоставляет методы сервиса классам лимитов HTTP API
+var methodClasses = map[string]string{
+	pb.Shortener_Shorten_FullMethodName:      ratelimit.ClassCreate,
+	pb.Shortener_ShortenBatch_FullMethodName: ratelimit.ClassBatch,
+	pb.Shortener_Expand_FullMethodName:       ratelimit.ClassRedirect,
+	pb.Shortener_DeleteURLs_FullMethodName:   ratelimit.ClassDelete,
+}
+
+// RateLimitInterceptor — аналог middleware.RateLimit для gRPC: те же корзины
+// по пользователю и адресу клиента и те же лимиты классов. Должен стоять
+// после AuthInterceptor. При сбое хранилища запрос пропускается.
+func RateLimitInterceptor(store ratelimit.Store, limits map[string]ratelimit.Limit) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		class, ok := methodClasses[info.FullMethod]
+		limit := limits[class]
+		if store == nil || !ok || !limit.Enabled() {
+			return handler(ctx, req)
+		}
+
+		keys := []string{class + ":ip:" + peerIP(ctx)}
+		if userID, ok := middleware.GetUserIDFromContext(ctx); ok && userID != "" {
+			keys = append(keys, class+":user:"+userID)
+		}
+
+		result, err := ratelimit.TakeAll(ctx, store, limit, keys...)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("Rate limit check failed: %v", err)
+			return handler(ctx, req)
+		}
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(class).Inc()
+			retryAfter := max(int(math.Ceil(result.RetryAfter.Seconds())), 1)
+			if err := grpc.SetHeader(ctx, metadata.Pairs(RetryAfterMetadataKey, strconv.Itoa(retryAfter))); err != nil {
+				logger.FromContext(ctx).Errorf("Failed to send retry-after: %v", err)
+			}
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// peerIP возвращает адрес соединения; gRPC-сервер принимает клиентов
+// напрямую, поэтому заголовкам прокси не доверяем
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,24 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDMetadataKey — ключ метаданных с идентификатором запроса
+const RequestIDMetadataKey = "x-request-id"
+
+// RequestIDInterceptor — аналог middleware.RequestID для gRPC: идентификатор
+// берётся из метаданных x-request-id или создаётся и возвращается в заголовке
+func RequestIDInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	requestID := middleware.ResolveRequestID(metadataValue(ctx, RequestIDMetadataKey))
+	ctx = logger.WithRequestID(ctx, requestID)
+	if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, requestID)); err != nil {
+		logger.FromContext(ctx).Errorf("Failed to send request ID: %v", err)
+	}
+	return handler(ctx, req)
+}
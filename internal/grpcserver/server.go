@@ -0,0 +1,230 @@
+package grpcserver
+
+//go:generate protoc -I ../../api/proto --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative shortener.proto
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/linarium/shortener/internal/config"
+	"github.com/linarium/shortener/internal/grpcserver/pb"
+	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+	"github.com/linarium/shortener/internal/ratelimit"
+	"github.com/linarium/shortener/internal/service"
+	"github.com/linarium/shortener/internal/usecase"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server реализует pb.ShortenerServer поверх того же usecase.Repository,
+// что и HTTP-обработчики
+type Server struct {
+	pb.UnimplementedShortenerServer
+
+	shortener usecase.Repository
+	config    config.Config
+}
+
+// NewServer создаёт gRPC-сервер с зарегистрированным сервисом,
+// RequestIDInterceptor, AuthInterceptor и RateLimitInterceptor. Если limiter
+// равен nil, лимиты запросов не применяются.
+func NewServer(cfg config.Config, shortener usecase.Repository, keys *middleware.Keyring, apiKeys middleware.APIKeyResolver, limiter ratelimit.Store, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(
+		RequestIDInterceptor,
+		AuthInterceptor(keys, apiKeys),
+		RateLimitInterceptor(limiter, cfg.RateLimits()),
+	))
+	server := grpc.NewServer(opts...)
+	pb.RegisterShortenerServer(server, &Server{shortener: shortener, config: cfg})
+	return server
+}
+
+func (s *Server) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	userID, err := requireUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "url is required")
+	}
+
+	shortKey, err := s.shortener.ShortenWithOptions(ctx, req.GetUrl(), userID, usecase.ShortenOptions{
+		Alias:     req.GetAlias(),
+		ExpiresAt: fromUnix(req.GetExpiresAt()),
+		TTL:       time.Duration(req.GetTtlSeconds()) * time.Second,
+	})
+	isDuplicate := errors.Is(err, usecase.ErrConflict)
+	if err != nil && !isDuplicate {
+		return nil, shortenError(ctx, err)
+	}
+
+	shortURL, err := s.buildShortURL(ctx, shortKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ShortenResponse{Result: shortURL, Conflict: isDuplicate}, nil
+}
+
+func (s *Server) ShortenBatch(ctx context.Context, req *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	userID, err := requireUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.GetItems()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty batch request")
+	}
+
+	batch := make(models.BatchRequest, len(req.GetItems()))
+	for i, item := range req.GetItems() {
+		batch[i] = models.BatchRequestItem{
+			CorrelationID: item.GetCorrelationId(),
+			OriginalURL:   item.GetOriginalUrl(),
+			Alias:         item.GetAlias(),
+			ExpiresAt:     fromUnix(item.GetExpiresAt()),
+			TTL:           item.GetTtlSeconds(),
+		}
+	}
+
+	shorts, err := s.shortener.ShortenBatch(ctx, batch, s.config.BaseURL, userID)
+	if err != nil {
+		return nil, shortenError(ctx, err)
+	}
+
+	resp := &pb.ShortenBatchResponse{Items: make([]*pb.BatchResult, len(shorts))}
+	for i, short := range shorts {
+		resp.Items[i] = &pb.BatchResult{CorrelationId: short.CorrelationID, ShortUrl: short.ShortURL}
+	}
+	return resp, nil
+}
+
+// Expand только разрешает ссылку и, в отличие от перехода по HTTP, не
+// учитывается в статистике переходов. Удалённая ссылка, как 410 Gone в HTTP,
+// отличается от несуществующей кодом FailedPrecondition.
+func (s *Server) Expand(ctx context.Context, req *pb.ExpandRequest) (*pb.ExpandResponse, error) {
+	if req.GetShortUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "short_url is required")
+	}
+
+	original, err := s.shortener.Expand(ctx, req.GetShortUrl())
+	switch {
+	case errors.Is(err, usecase.ErrNotFound):
+		return nil, status.Error(codes.NotFound, "URL not found")
+	case errors.Is(err, usecase.ErrGone):
+		return nil, status.Error(codes.FailedPrecondition, "URL has been deleted")
+	case err != nil:
+		return nil, storageError(ctx, "failed to expand URL", err)
+	}
+	if err := s.shortener.CheckDestination(original); err != nil {
+		return nil, status.Error(codes.PermissionDenied, "destination is blocked by policy")
+	}
+
+	return &pb.ExpandResponse{OriginalUrl: original}, nil
+}
+
+func (s *Server) GetUserURLs(ctx context.Context, _ *pb.GetUserURLsRequest) (*pb.GetUserURLsResponse, error) {
+	userID, err := requireUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	urls, err := s.shortener.GetUserURLs(ctx, userID)
+	if err != nil {
+		return nil, storageError(ctx, "failed to get user urls", err)
+	}
+
+	resp := &pb.GetUserURLsResponse{Urls: make([]*pb.UserURL, len(urls))}
+	for i, u := range urls {
+		shortURL, err := s.buildShortURL(ctx, u.ShortURL)
+		if err != nil {
+			return nil, err
+		}
+		resp.Urls[i] = &pb.UserURL{ShortUrl: shortURL, OriginalUrl: u.OriginalURL}
+		if u.ExpiresAt != nil {
+			resp.Urls[i].ExpiresAt = u.ExpiresAt.Unix()
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) DeleteURLs(ctx context.Context, req *pb.DeleteURLsRequest) (*pb.DeleteURLsResponse, error) {
+	userID, err := requireUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.GetShortUrls()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "short_urls is required")
+	}
+
+	err = s.shortener.DeleteURLs(ctx, userID, req.GetShortUrls())
+	if errors.Is(err, service.ErrDeletionQueueFull) || errors.Is(err, service.ErrDeletionQueueClosed) {
+		return nil, status.Error(codes.Unavailable, "deletion queue is full, retry later")
+	}
+	if err != nil {
+		return nil, storageError(ctx, "failed to delete urls", err)
+	}
+
+	return &pb.DeleteURLsResponse{}, nil
+}
+
+func (s *Server) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if err := s.shortener.Ping(ctx); err != nil {
+		return nil, status.Error(codes.Unavailable, "storage is unavailable")
+	}
+	return &pb.PingResponse{}, nil
+}
+
+func (s *Server) buildShortURL(ctx context.Context, shortKey string) (string, error) {
+	shortURL, err := url.JoinPath(s.config.BaseURL, shortKey)
+	if err != nil {
+		logger.FromContext(ctx).Errorf("Failed to build short URL: %v", err)
+		return "", status.Error(codes.Internal, "failed to build short URL")
+	}
+	return shortURL, nil
+}
+
+func requireUserID(ctx context.Context) (string, error) {
+	userID, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok || userID == "" {
+		return "", status.Error(codes.Unauthenticated, "user is not authenticated")
+	}
+	return userID, nil
+}
+
+// shortenError переводит ошибки сокращения в коды gRPC так же, как
+// writeShortenError переводит их в HTTP-статусы
+func shortenError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidURL), errors.Is(err, usecase.ErrInvalidAlias), errors.Is(err, usecase.ErrInvalidExpiry):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, usecase.ErrAliasTaken):
+		return status.Error(codes.AlreadyExists, "alias is already taken")
+	case errors.Is(err, usecase.ErrURLBlocked):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return storageError(ctx, "failed to shorten URL", err)
+	}
+}
+
+// storageError переводит ErrUnavailable в codes.Unavailable, остальные
+// ошибки — в codes.Internal с сообщением msg
+func storageError(ctx context.Context, msg string, err error) error {
+	logger.FromContext(ctx).Errorf("%s: %v", msg, err)
+	if errors.Is(err, usecase.ErrUnavailable) {
+		return status.Error(codes.Unavailable, "storage is temporarily unavailable")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+func fromUnix(seconds int64) *time.Time {
+	if seconds == 0 {
+		return nil
+	}
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
@@ -0,0 +1,160 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/linarium/shortener/internal/config"
+	"github.com/linarium/shortener/internal/grpcserver/pb"
+	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/ratelimit"
+	"github.com/linarium/shortener/internal/service"
+	"github.com/linarium/shortener/internal/usecase"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T) pb.ShortenerClient {
+	t.Helper()
+	return newLimitedTestClient(t, config.Config{}, nil)
+}
+
+func newLimitedTestClient(t *testing.T, cfg config.Config, limiter ratelimit.Store) pb.ShortenerClient {
+	t.Helper()
+	logger.Initialize()
+
+	cfg.BaseURL = "http://localhost:8080"
+	cfg.SecretKey = "test-secret-key"
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+
+	keys, _ := middleware.NewKeyring(cfg.SecretKeys())
+
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(cfg, shortener, keys, nil, limiter)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewShortenerClient(conn)
+}
+
+func TestShortenIssuesUserToken(t *testing.T) {
+	client := newTestClient(t)
+
+	var header metadata.MD
+	resp, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://example.com"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if !strings.HasPrefix(resp.GetResult(), "http://localhost:8080/") {
+		t.Errorf("unexpected short URL %q", resp.GetResult())
+	}
+
+	tokens := header.Get(UserIDMetadataKey)
+	if len(tokens) != 1 {
+		t.Fatalf("expected user token in response header, got %v", header)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), UserIDMetadataKey, tokens[0])
+	urls, err := client.GetUserURLs(ctx, &pb.GetUserURLsRequest{})
+	if err != nil {
+		t.Fatalf("GetUserURLs failed: %v", err)
+	}
+	if len(urls.GetUrls()) != 1 || urls.GetUrls()[0].GetShortUrl() != resp.GetResult() {
+		t.Errorf("expected the shortened URL to belong to the user, got %v", urls.GetUrls())
+	}
+
+	other, err := client.GetUserURLs(context.Background(), &pb.GetUserURLsRequest{})
+	if err != nil {
+		t.Fatalf("GetUserURLs failed: %v", err)
+	}
+	if len(other.GetUrls()) != 0 {
+		t.Errorf("expected a new user to have no URLs, got %v", other.GetUrls())
+	}
+}
+
+func TestExpand(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://example.com", Alias: "grpc-link"}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+
+	resp, err := client.Expand(ctx, &pb.ExpandRequest{ShortUrl: "grpc-link"})
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+	if resp.GetOriginalUrl() != "https://example.com" {
+		t.Errorf("expected https://example.com, got %q", resp.GetOriginalUrl())
+	}
+
+	_, err = client.Expand(ctx, &pb.ExpandRequest{ShortUrl: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "https://example.org", Alias: "grpc-link"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists for a taken alias, got %v", err)
+	}
+}
+
+func TestExpandDeleted(t *testing.T) {
+	client := newTestClient(t)
+
+	var header metadata.MD
+	if _, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://example.com", Alias: "gone-link"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), UserIDMetadataKey, header.Get(UserIDMetadataKey)[0])
+	if _, err := client.DeleteURLs(ctx, &pb.DeleteURLsRequest{ShortUrls: []string{"gone-link"}}); err != nil {
+		t.Fatalf("DeleteURLs failed: %v", err)
+	}
+
+	_, err := client.Expand(context.Background(), &pb.ExpandRequest{ShortUrl: "gone-link"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for a deleted link, got %v", err)
+	}
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	limiter := ratelimit.NewMemoryStore()
+	t.Cleanup(func() { limiter.Close() })
+	client := newLimitedTestClient(t, config.Config{RateLimitCreate: "1/m"}, limiter)
+
+	if _, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://example.com/1"}); err != nil {
+		t.Fatalf("first Shorten failed: %v", err)
+	}
+
+	var header metadata.MD
+	_, err := client.Shorten(context.Background(), &pb.ShortenRequest{Url: "https://example.com/2"}, grpc.Header(&header))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+	if len(header.Get(RetryAfterMetadataKey)) != 1 {
+		t.Errorf("expected retry-after in response header, got %v", header)
+	}
+
+	if _, err := client.Expand(context.Background(), &pb.ExpandRequest{ShortUrl: "missing"}); status.Code(err) == codes.ResourceExhausted {
+		t.Errorf("redirect limit is off, got %v", err)
+	}
+}
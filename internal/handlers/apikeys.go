@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+	"github.com/linarium/shortener/internal/usecase"
+)
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type apiKeyResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"created_at"`
+	// Key заполняется только в ответе на создание
+	Key string `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(key models.APIKey) apiKeyResponse {
+	return apiKeyResponse{ID: key.ID, Name: key.Name, Prefix: key.Prefix, CreatedAt: key.CreatedAt}
+}
+
+// APIKeyHandler управляет ключами доступа текущего пользователя
+type APIKeyHandler struct {
+	apiKeys usecase.APIKeys
+}
+
+func NewAPIKeyHandler(apiKeys usecase.APIKeys) *APIKeyHandler {
+	return &APIKeyHandler{apiKeys: apiKeys}
+}
+
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	key, secret, err := h.apiKeys.CreateAPIKey(r.Context(), userID, req.Name)
+	if errors.Is(err, usecase.ErrInvalidAPIKeyName) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to create API key: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := newAPIKeyResponse(key)
+	response.Key = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.FromContext(r.Context()).Errorf("failed to encode response: %v", err)
+	}
+}
+
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := h.apiKeys.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to list API keys: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	response := make([]apiKeyResponse, len(keys))
+	for i, key := range keys {
+		response[i] = newAPIKeyResponse(key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.FromContext(r.Context()).Errorf("failed to encode response: %v", err)
+	}
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := h.apiKeys.RevokeAPIKey(r.Context(), userID, chi.URLParam(r, "id"))
+	if errors.Is(err, usecase.ErrAPIKeyNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to revoke API key: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
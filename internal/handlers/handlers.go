@@ -2,14 +2,21 @@ package handlers
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/linarium/shortener/internal/handlers/middleware"
 	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/metrics"
+	"github.com/linarium/shortener/internal/service"
 	"github.com/linarium/shortener/internal/usecase"
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/linarium/shortener/internal/config"
@@ -18,6 +25,12 @@ import (
 
 const defaultContentType = "text/plain"
 
+type userURLResponse struct {
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
 type URLHandler struct {
 	shortener usecase.Repository
 	config    config.Config
@@ -55,24 +68,38 @@ func (h *URLHandler) buildShortURL(shortKey string) (string, error) {
 func (h *URLHandler) createJSONShortURL(w http.ResponseWriter, r *http.Request) {
 	userID, ok := h.getUserID(r.Context())
 	if !ok {
-		logger.Sugar.Error("user ID not found in context")
+		logger.FromContext(r.Context()).Error("user ID not found in context")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	var request struct {
-		URL string `json:"url"`
+		URL       string     `json:"url"`
+		Alias     string     `json:"alias,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		// TTL — срок жизни ссылки в секундах
+		TTL int64 `json:"ttl,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
 		return
 	}
 
-	shortKey, isDuplicate := h.shortener.Shorten(r.Context(), request.URL, userID)
+	opts := usecase.ShortenOptions{
+		Alias:     request.Alias,
+		ExpiresAt: request.ExpiresAt,
+		TTL:       time.Duration(request.TTL) * time.Second,
+	}
+	shortKey, err := h.shortener.ShortenWithOptions(r.Context(), request.URL, userID, opts)
+	isDuplicate := errors.Is(err, usecase.ErrConflict)
+	if err != nil && !isDuplicate {
+		h.writeShortenError(w, r, err)
+		return
+	}
 
 	shortURL, err := h.buildShortURL(shortKey)
 	if err != nil {
-		logger.Sugar.Errorf("Failed to build short URL: %v", err)
+		logger.FromContext(r.Context()).Errorf("Failed to build short URL: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -85,15 +112,42 @@ func (h *URLHandler) createJSONShortURL(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Set("Content-Type", "application/json")
 	if isDuplicate {
+		metrics.ShortenConflicts.Inc()
 		w.WriteHeader(http.StatusConflict)
 	} else {
+		metrics.Shortened.Inc()
 		w.WriteHeader(http.StatusCreated)
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		logger.Sugar.Errorf("Failed to encode response: %v", err)
+		logger.FromContext(r.Context()).Errorf("Failed to encode response: %v", err)
+		return
+	}
+}
+
+// writeShortenError отвечает на ошибки в параметрах сокращения
+func (h *URLHandler) writeShortenError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidURL), errors.Is(err, usecase.ErrInvalidAlias), errors.Is(err, usecase.ErrInvalidExpiry):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrAliasTaken):
+		http.Error(w, "Alias is already taken", http.StatusConflict)
+	case errors.Is(err, usecase.ErrURLBlocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		writeStorageError(w, r, "Failed to shorten URL", err)
+	}
+}
+
+// writeStorageError отвечает 503, если хранилище временно недоступно, и 500
+// на остальные ошибки; msg и err пишутся в лог
+func writeStorageError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	logger.FromContext(r.Context()).Errorf("%s: %v", msg, err)
+	if errors.Is(err, usecase.ErrUnavailable) {
+		http.Error(w, "Storage is temporarily unavailable", http.StatusServiceUnavailable)
 		return
 	}
+	w.WriteHeader(http.StatusInternalServerError)
 }
 
 func (h *URLHandler) createShortURL(w http.ResponseWriter, r *http.Request) {
@@ -104,7 +158,7 @@ func (h *URLHandler) createShortURL(w http.ResponseWriter, r *http.Request) {
 
 	userID, ok := h.getUserID(r.Context())
 	if !ok {
-		logger.Sugar.Error("user ID not found in context")
+		logger.FromContext(r.Context()).Error("user ID not found in context")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -123,24 +177,31 @@ func (h *URLHandler) createShortURL(w http.ResponseWriter, r *http.Request) {
 	input := string(body)
 	w.Header().Set("Content-Type", defaultContentType)
 
-	shortKey, isDuplicate := h.shortener.Shorten(r.Context(), input, userID)
+	shortKey, err := h.shortener.Shorten(r.Context(), input, userID)
+	isDuplicate := errors.Is(err, usecase.ErrConflict)
+	if err != nil && !isDuplicate {
+		h.writeShortenError(w, r, err)
+		return
+	}
 
 	resultURL, err := h.buildShortURL(shortKey)
 	if err != nil {
-		logger.Sugar.Errorf("Failed to build short URL: %v", err)
+		logger.FromContext(r.Context()).Errorf("Failed to build short URL: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", defaultContentType)
 	if isDuplicate {
+		metrics.ShortenConflicts.Inc()
 		w.WriteHeader(http.StatusConflict)
 	} else {
+		metrics.Shortened.Inc()
 		w.WriteHeader(http.StatusCreated)
 	}
 
 	if _, err := w.Write([]byte(resultURL)); err != nil {
-		logger.Sugar.Errorf("Failed to write response: %v", err)
+		logger.FromContext(r.Context()).Errorf("Failed to write response: %v", err)
 		return
 	}
 }
@@ -152,21 +213,92 @@ func (h *URLHandler) getURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, exists, isDeleted := h.shortener.Expand(r.Context(), id)
-
-	if !exists {
+	url, err := h.shortener.Expand(r.Context(), id)
+	switch {
+	case errors.Is(err, usecase.ErrNotFound):
 		http.Error(w, "URL not found", http.StatusBadRequest)
 		return
+	case errors.Is(err, usecase.ErrGone):
+		metrics.Gone.Inc()
+		http.Error(w, "URL has been deleted", http.StatusGone)
+		return
+	case err != nil:
+		writeStorageError(w, r, "Failed to expand URL", err)
+		return
 	}
 
-	if isDeleted {
-		http.Error(w, "URL has been deleted", http.StatusGone)
+	if err := h.shortener.CheckDestination(url); err != nil {
+		logger.FromContext(r.Context()).Infof("Blocked redirect from %s: %v", id, err)
+		http.Error(w, "Destination is blocked by policy", http.StatusForbidden)
 		return
 	}
 
+	click := models.Click{
+		ShortURL:  id,
+		Timestamp: time.Now().UTC(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IPHash:    hashClientIP(middleware.ClientIP(r), h.config.ClickIPSalt),
+	}
+	if err := h.shortener.RecordClick(r.Context(), click); err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to record click on %s: %v", id, err)
+	}
+
+	metrics.Redirects.Inc()
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
+// hashClientIP скрывает адрес клиента в статистике: хранится только HMAC от него
+func hashClientIP(ip, salt string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetURLStats отдаёт владельцу статистику переходов по его ссылке
+func (h *URLHandler) GetURLStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.getUserID(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.shortener.GetClickStats(r.Context(), userID, id)
+	switch {
+	case errors.Is(err, usecase.ErrNotFound):
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	case errors.Is(err, usecase.ErrNotOwner):
+		http.Error(w, "URL belongs to another user", http.StatusForbidden)
+		return
+	case err != nil:
+		writeStorageError(w, r, "Failed to get click stats", err)
+		return
+	}
+
+	shortURL, err := h.buildShortURL(stats.ShortURL)
+	if err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to build short URL: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	stats.ShortURL = shortURL
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logger.FromContext(r.Context()).Errorf("failed to encode response: %v", err)
+		return
+	}
+}
+
 func (h *URLHandler) GetURLs(w http.ResponseWriter, r *http.Request) {
 	userID, ok := h.getUserID(r.Context())
 	if !ok {
@@ -177,8 +309,7 @@ func (h *URLHandler) GetURLs(w http.ResponseWriter, r *http.Request) {
 
 	urls, err := h.shortener.GetUserURLs(r.Context(), userID)
 	if err != nil {
-		logger.Sugar.Errorf("failed to get user urls: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStorageError(w, r, "failed to get user urls", err)
 		return
 	}
 
@@ -188,25 +319,20 @@ func (h *URLHandler) GetURLs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Преобразуем в нужный формат ответа
-	response := make([]struct {
-		ShortURL    string `json:"short_url"`
-		OriginalURL string `json:"original_url"`
-	}, len(urls))
+	response := make([]userURLResponse, len(urls))
 
 	for i, url := range urls {
 		shortURL, err := h.buildShortURL(url.ShortURL)
 		if err != nil {
-			logger.Sugar.Errorf("Failed to build short URL: %v", err)
+			logger.FromContext(r.Context()).Errorf("Failed to build short URL: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		response[i] = struct {
-			ShortURL    string `json:"short_url"`
-			OriginalURL string `json:"original_url"`
-		}{
+		response[i] = userURLResponse{
 			ShortURL:    shortURL,
 			OriginalURL: url.OriginalURL,
+			ExpiresAt:   url.ExpiresAt,
 		}
 	}
 
@@ -214,7 +340,7 @@ func (h *URLHandler) GetURLs(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		logger.Sugar.Errorf("failed to encode response: %v", err)
+		logger.FromContext(r.Context()).Errorf("failed to encode response: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -229,22 +355,22 @@ func (h *URLHandler) PingDB(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *URLHandler) ShortenBatch(w http.ResponseWriter, r *http.Request) {
-	logger.Sugar.Info("ShortenBatch called")
+	logger.FromContext(r.Context()).Info("ShortenBatch called")
 
 	userID, ok := h.getUserID(r.Context())
 	if !ok {
-		logger.Sugar.Error("user ID not found in context")
+		logger.FromContext(r.Context()).Error("user ID not found in context")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	logger.Sugar.Infof("User ID: %s", userID)
+	logger.FromContext(r.Context()).Infof("User ID: %s", userID)
 
 	var req models.BatchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
-	logger.Sugar.Infof("Received %d URLs to shorten", len(req))
+	logger.FromContext(r.Context()).Infof("Received %d URLs to shorten", len(req))
 
 	if len(req) == 0 {
 		http.Error(w, "Empty batch request", http.StatusBadRequest)
@@ -252,17 +378,23 @@ func (h *URLHandler) ShortenBatch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp, err := h.shortener.ShortenBatch(r.Context(), req, h.config.BaseURL, userID)
+	if errors.Is(err, usecase.ErrInvalidURL) || errors.Is(err, usecase.ErrInvalidAlias) ||
+		errors.Is(err, usecase.ErrAliasTaken) || errors.Is(err, usecase.ErrInvalidExpiry) ||
+		errors.Is(err, usecase.ErrURLBlocked) {
+		h.writeShortenError(w, r, err)
+		return
+	}
 	if err != nil {
-		logger.Sugar.Errorf("Error in ShortenBatch: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeStorageError(w, r, "Error in ShortenBatch", err)
 		return
 	}
 
+	metrics.Shortened.Add(float64(len(resp)))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		logger.Sugar.Errorf("Error encoding response: %v", err)
+		logger.FromContext(r.Context()).Errorf("Error encoding response: %v", err)
 		http.Error(w, "Failed to prepare response", http.StatusInternalServerError)
 		return
 	}
@@ -276,33 +408,78 @@ func (h *URLHandler) DeleteURLs(w http.ResponseWriter, r *http.Request) {
 
 	userID, ok := h.getUserID(r.Context())
 	if !ok {
-		logger.Sugar.Warn("Unauthorized access to delete URLs")
+		logger.FromContext(r.Context()).Warn("Unauthorized access to delete URLs")
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
 	var shortURLs []string
 	if err := json.NewDecoder(r.Body).Decode(&shortURLs); err != nil {
-		logger.Sugar.Errorf("Error decoding delete request: %v", err)
+		logger.FromContext(r.Context()).Errorf("Error decoding delete request: %v", err)
 		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
 		return
 	}
 
 	if len(shortURLs) == 0 {
-		logger.Sugar.Warn("Empty delete request")
+		logger.FromContext(r.Context()).Warn("Empty delete request")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	logger.Sugar.Infof("User %s requested deletion of %d URLs", userID, len(shortURLs))
+	logger.FromContext(r.Context()).Infof("User %s requested deletion of %d URLs", userID, len(shortURLs))
 
-	go func() {
-		if err := h.shortener.DeleteURLs(context.Background(), userID, shortURLs); err != nil {
-			logger.Sugar.Errorf("Error deleting URLs: %v", err)
-		} else {
-			logger.Sugar.Infof("Successfully processed deletion of %d URLs for user %s", len(shortURLs), userID)
-		}
-	}()
+	err := h.shortener.DeleteURLs(r.Context(), userID, shortURLs)
+	if errors.Is(err, service.ErrDeletionQueueFull) || errors.Is(err, service.ErrDeletionQueueClosed) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Deletion queue is full, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		writeStorageError(w, r, "Error deleting URLs", err)
+		return
+	}
 
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// GetStats возвращает число ссылок и пользователей сервиса
+func (h *URLHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.shortener.Stats(r.Context())
+	if err != nil {
+		writeStorageError(w, r, "Failed to get stats", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logger.FromContext(r.Context()).Errorf("failed to encode response: %v", err)
+	}
+}
+
+// DeletionStats отдаёт состояние очереди удаления
+func (h *URLHandler) DeletionStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(h.shortener.DeletionStats()); err != nil {
+		logger.FromContext(r.Context()).Errorf("failed to encode response: %v", err)
+		return
+	}
+}
+
+// CompactStorage запускает уплотнение хранилища по запросу администратора
+func (h *URLHandler) CompactStorage(w http.ResponseWriter, r *http.Request) {
+	err := h.shortener.Compact(r.Context())
+	if errors.Is(err, service.ErrCompactionNotSupported) {
+		http.Error(w, "Storage does not support compaction", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to compact storage: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -2,14 +2,23 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/linarium/shortener/internal/handlers/middleware"
 	"github.com/linarium/shortener/internal/usecase"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/linarium/shortener/internal/config"
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+	"github.com/linarium/shortener/internal/policy"
 	"github.com/linarium/shortener/internal/service"
 
 	"github.com/go-chi/chi/v5"
@@ -22,7 +31,7 @@ func TestCreateShortURL(t *testing.T) {
 		SecretKey:     "test-secret-key",
 	}
 	storage, _ := service.NewMemoryStorage(context.Background())
-	shortener := usecase.NewShortenerService(storage)
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
 
 	handler := NewURLHandler(cfg, shortener)
 
@@ -101,7 +110,7 @@ func TestGetURL(t *testing.T) {
 		SecretKey:     "test-secret-key",
 	}
 	storage, _ := service.NewMemoryStorage(context.Background())
-	shortener := usecase.NewShortenerService(storage)
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
 
 	handler := NewURLHandler(cfg, shortener)
 
@@ -166,7 +175,7 @@ func TestGetURLs(t *testing.T) {
 		SecretKey:     "test-secret-key",
 	}
 	storage, _ := service.NewMemoryStorage(context.Background())
-	shortener := usecase.NewShortenerService(storage)
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
 
 	handler := NewURLHandler(cfg, shortener)
 
@@ -229,7 +238,7 @@ func TestCreateJSONShortURL(t *testing.T) {
 		SecretKey:     "test-secret-key",
 	}
 	storage, _ := service.NewMemoryStorage(context.Background())
-	shortener := usecase.NewShortenerService(storage)
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
 
 	handler := NewURLHandler(cfg, shortener)
 
@@ -255,7 +264,19 @@ func TestCreateJSONShortURL(t *testing.T) {
 			name:           "Empty URL",
 			body:           `{"url": ""}`,
 			userID:         "test-user-id",
-			expectedStatus: http.StatusCreated,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "JavaScript URI",
+			body:           `{"url": "javascript:alert(1)"}`,
+			userID:         "test-user-id",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Plain text",
+			body:           `{"url": "not a url"}`,
+			userID:         "test-user-id",
+			expectedStatus: http.StatusBadRequest,
 		},
 	}
 
@@ -281,3 +302,708 @@ func TestCreateJSONShortURL(t *testing.T) {
 		})
 	}
 }
+
+func TestUserURLsOwnership(t *testing.T) {
+	cfg := config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     "test-secret-key",
+	}
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+
+	handler := NewURLHandler(cfg, shortener)
+
+	ctx := context.Background()
+	ownerKey, _ := handler.shortener.Shorten(ctx, "http://owner.com", "owner")
+	otherKey, _ := handler.shortener.Shorten(ctx, "http://other.com", "other")
+
+	// Чужие ссылки не удаляются
+	if err := handler.shortener.DeleteURLs(ctx, "owner", []string{ownerKey, otherKey}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+	}{
+		{
+			name:           "Deleted by owner",
+			id:             ownerKey,
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:           "Owned by another user",
+			id:             otherKey,
+			expectedStatus: http.StatusTemporaryRedirect,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.id, nil)
+			w := httptest.NewRecorder()
+
+			r := chi.NewRouter()
+			r.Get("/{id}", handler.getURL)
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	urls, err := handler.shortener.GetUserURLs(ctx, "other")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(urls) != 1 || urls[0].ShortURL != otherKey {
+		t.Errorf("expected only %s for other user, got %v", otherKey, urls)
+	}
+
+	urls, err = handler.shortener.GetUserURLs(ctx, "owner")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(urls) != 0 {
+		t.Errorf("expected no URLs for owner after deletion, got %v", urls)
+	}
+}
+
+func TestCreateJSONShortURLAlias(t *testing.T) {
+	cfg := config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     "test-secret-key",
+	}
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+
+	handler := NewURLHandler(cfg, shortener)
+
+	// Случаи выполняются по порядку: второй занимает алиас первого
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Valid alias",
+			body:           `{"url": "http://example.com", "alias": "my-link"}`,
+			expectedStatus: http.StatusCreated,
+			expectedBody:   `{"result":"http://localhost:8080/my-link"}`,
+		},
+		{
+			name:           "Alias taken",
+			body:           `{"url": "http://other.com", "alias": "my-link"}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Reserved alias",
+			body:           `{"url": "http://other.com", "alias": "Ping"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid characters",
+			body:           `{"url": "http://other.com", "alias": "my link"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Too short",
+			body:           `{"url": "http://other.com", "alias": "ab"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, "test-user-id")
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+
+			handler.createJSONShortURL(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if tt.expectedBody != "" {
+				if body := strings.TrimSpace(w.Body.String()); body != tt.expectedBody {
+					t.Errorf("expected body %s, got %s", tt.expectedBody, body)
+				}
+			}
+		})
+	}
+}
+
+func TestGetExpiredURL(t *testing.T) {
+	cfg := config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     "test-secret-key",
+	}
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+
+	handler := NewURLHandler(cfg, shortener)
+
+	expired := time.Now().Add(-time.Minute)
+	storage.SaveShortURL(context.Background(), models.URL{
+		ID:          "expired-id",
+		UserID:      "test-user-id",
+		ShortURL:    "expired",
+		OriginalURL: "http://expired.com",
+		ExpiresAt:   &expired,
+	})
+
+	active, err := handler.shortener.ShortenWithOptions(context.Background(), "http://active.com", "test-user-id", usecase.ShortenOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := handler.shortener.ShortenWithOptions(context.Background(), "http://past.com", "test-user-id", usecase.ShortenOptions{ExpiresAt: &expired}); !errors.Is(err, usecase.ErrInvalidExpiry) {
+		t.Errorf("expected ErrInvalidExpiry for past expires_at, got %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+	}{
+		{
+			name:           "Expired link",
+			id:             "expired",
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:           "Link with TTL",
+			id:             active,
+			expectedStatus: http.StatusTemporaryRedirect,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.id, nil)
+			w := httptest.NewRecorder()
+
+			r := chi.NewRouter()
+			r.Get("/{id}", handler.getURL)
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	marked, err := storage.MarkExpired(context.Background(), time.Now())
+	if err != nil || marked != 1 {
+		t.Errorf("expected reaper to mark 1 URL, got %d (%v)", marked, err)
+	}
+}
+
+func TestGetURLStats(t *testing.T) {
+	cfg := config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     "test-secret-key",
+	}
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+
+	handler := NewURLHandler(cfg, shortener)
+
+	shortKey, _ := handler.shortener.Shorten(context.Background(), "http://example.com", "owner")
+
+	r := chi.NewRouter()
+	r.Get("/{id}", handler.getURL)
+	r.Get("/api/user/urls/{id}/stats", handler.GetURLStats)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/"+shortKey, nil)
+		req.Header.Set("Referer", "http://referrer.com")
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+	}
+
+	tests := []struct {
+		name           string
+		id             string
+		userID         string
+		expectedStatus int
+	}{
+		{
+			name:           "Owner",
+			id:             shortKey,
+			userID:         "owner",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Another user",
+			id:             shortKey,
+			userID:         "other",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Unknown link",
+			id:             "nonexistent",
+			userID:         "owner",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+tt.id+"/stats", nil)
+			ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, tt.userID)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var stats models.ClickStats
+			if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+				t.Fatalf("failed to decode stats: %v", err)
+			}
+			if stats.Total != 2 || len(stats.Recent) != 2 {
+				t.Errorf("expected 2 clicks, got total=%d recent=%d", stats.Total, len(stats.Recent))
+			}
+			if click := stats.Recent[0]; click.Referrer != "http://referrer.com" || click.IPHash == "" || click.IPHash == "10.0.0.1" {
+				t.Errorf("unexpected click %+v", click)
+			}
+		})
+	}
+}
+
+func TestIssueToken(t *testing.T) {
+	logger.Initialize()
+
+	cfg := config.Config{
+		BaseURL:   "http://localhost:8080",
+		SecretKey: "test-secret-key",
+		JWTTTL:    time.Hour,
+	}
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+	keys, _ := middleware.NewKeyring(cfg.SecretKeys())
+	r := Router(cfg, shortener, keys, usecase.NewAPIKeyService(service.NewMemoryAPIKeyStore()), nil)
+
+	// Сокращаем ссылку в браузерной сессии
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("expected auth cookie")
+	}
+
+	// Обмениваем куку на токен
+	req = httptest.NewRequest(http.MethodPost, "/api/user/token", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var token tokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&token); err != nil {
+		t.Fatalf("failed to decode token: %v", err)
+	}
+
+	// С токеном видны ссылки той же сессии
+	req = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var urls []userURLResponse
+	if err := json.NewDecoder(w.Body).Decode(&urls); err != nil {
+		t.Fatalf("failed to decode urls: %v", err)
+	}
+	if len(urls) != 1 || urls[0].OriginalURL != "https://example.com" {
+		t.Errorf("expected the browser session URL, got %+v", urls)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	logger.Initialize()
+
+	cfg := config.Config{BaseURL: "http://localhost:8080", SecretKey: "test-secret-key"}
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+	keys, _ := middleware.NewKeyring(cfg.SecretKeys())
+	r := Router(cfg, shortener, keys, usecase.NewAPIKeyService(service.NewMemoryAPIKeyStore()), nil)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Создаём ключ из браузерной сессии
+	w := serve(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com")))
+	cookie := w.Result().Cookies()[0]
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/keys", strings.NewReader(`{"name":"ci"}`))
+	req.AddCookie(cookie)
+	w = serve(req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", w.Code)
+	}
+	var created apiKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode key: %v", err)
+	}
+	if created.Key == "" || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Fatalf("expected key starting with prefix %q, got %q", created.Prefix, created.Key)
+	}
+
+	// Ключ работает от имени владельца
+	req = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req.Header.Set(middleware.APIKeyHeader, created.Key)
+	if w = serve(req); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 with API key, got %d", w.Code)
+	}
+
+	// В списке ключ виден без секрета
+	req = httptest.NewRequest(http.MethodGet, "/api/user/keys", nil)
+	req.Header.Set(middleware.APIKeyHeader, created.Key)
+	w = serve(req)
+	if strings.Contains(w.Body.String(), created.Key) || !strings.Contains(w.Body.String(), created.Prefix) {
+		t.Errorf("expected list with prefix only, got %s", w.Body.String())
+	}
+
+	// Ключом нельзя выпустить токен или новый ключ, которые переживут его отзыв
+	for _, path := range []string{"/api/user/token", "/api/user/keys"} {
+		req = httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"name":"leak"}`))
+		req.Header.Set(middleware.APIKeyHeader, created.Key)
+		if w = serve(req); w.Code != http.StatusForbidden {
+			t.Errorf("expected status 403 for %s with API key, got %d", path, w.Code)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/user/keys/not-a-uuid", nil)
+	req.AddCookie(cookie)
+	if w = serve(req); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for malformed key id, got %d", w.Code)
+	}
+
+	// После отзыва ключ отклоняется
+	req = httptest.NewRequest(http.MethodDelete, "/api/user/keys/"+created.ID, nil)
+	req.AddCookie(cookie)
+	if w = serve(req); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204 on revoke, got %d", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req.Header.Set(middleware.APIKeyHeader, created.Key)
+	if w = serve(req); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for revoked key, got %d", w.Code)
+	}
+}
+
+func TestInternalStats(t *testing.T) {
+	logger.Initialize()
+
+	storage, _ := service.NewMemoryStorage(context.Background())
+	for i, owner := range []string{"user-1", "user-1", "user-2"} {
+		storage.SaveShortURL(context.Background(), models.URL{
+			ShortURL:    "short" + string(rune('a'+i)),
+			OriginalURL: "https://example.com/" + string(rune('a'+i)),
+			UserID:      owner,
+		})
+	}
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+	keys, _ := middleware.NewKeyring([]string{"test-secret-key"})
+	apiKeys := usecase.NewAPIKeyService(service.NewMemoryAPIKeyStore())
+
+	tests := []struct {
+		name           string
+		subnet         string
+		realIP         string
+		expectedStatus int
+	}{
+		{name: "Trusted address", subnet: "10.0.0.0/8", realIP: "10.1.2.3", expectedStatus: http.StatusOK},
+		{name: "Untrusted address", subnet: "10.0.0.0/8", realIP: "192.168.1.1", expectedStatus: http.StatusForbidden},
+		{name: "Missing X-Real-IP", subnet: "10.0.0.0/8", expectedStatus: http.StatusForbidden},
+		{name: "No trusted subnet", realIP: "10.1.2.3", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{BaseURL: "http://localhost:8080", TrustedSubnet: tt.subnet}
+			r := Router(cfg, shortener, keys, apiKeys, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var stats models.Stats
+			if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+				t.Fatalf("failed to decode stats: %v", err)
+			}
+			if stats.URLs != 3 || stats.Users != 2 {
+				t.Errorf("expected 3 urls and 2 users, got %+v", stats)
+			}
+		})
+	}
+}
+
+// Служебные маршруты закрыты для всех, кто не пришёл из доверенной подсети,
+// в том числе для пользователей с действующей кукой
+func TestAdminRoutesRequireTrustedSubnet(t *testing.T) {
+	logger.Initialize()
+
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+	keys, _ := middleware.NewKeyring([]string{"test-secret-key"})
+	apiKeys := usecase.NewAPIKeyService(service.NewMemoryAPIKeyStore())
+	cfg := config.Config{BaseURL: "http://localhost:8080", TrustedSubnet: "10.0.0.0/8"}
+	r := Router(cfg, shortener, keys, apiKeys, nil)
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodPost, path: "/api/internal/compact"},
+		{method: http.MethodGet, path: "/api/internal/deletions"},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			req := httptest.NewRequest(route.method, route.path, nil)
+			req.Header.Set("X-Real-IP", "192.168.1.1")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected status 403 for untrusted caller, got %d", w.Code)
+			}
+
+			// Повтор с выданной кукой ничего не меняет
+			req = httptest.NewRequest(route.method, route.path, nil)
+			req.Header.Set("X-Real-IP", "192.168.1.1")
+			for _, cookie := range w.Result().Cookies() {
+				req.AddCookie(cookie)
+			}
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected status 403 for cookie holder, got %d", w.Code)
+			}
+
+			req = httptest.NewRequest(route.method, route.path, nil)
+			req.Header.Set("X-Real-IP", "10.1.2.3")
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code == http.StatusForbidden {
+				t.Errorf("expected trusted caller to pass, got 403")
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	logger.Initialize()
+
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+	keys, _ := middleware.NewKeyring([]string{"test-secret-key"})
+	apiKeys := usecase.NewAPIKeyService(service.NewMemoryAPIKeyStore())
+	r := Router(config.Config{BaseURL: "http://localhost:8080"}, shortener, keys, apiKeys, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com"))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("metrics endpoint should not issue auth cookies")
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`shortener_http_requests_total{method="POST",route="/",status="201"}`,
+		"shortener_links_shortened_total",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	logger.Initialize()
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"rules": [{"action": "deny", "suffix": "phish.example"}]}`), 0644); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	engine, err := policy.Load(path)
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+
+	storage, _ := service.NewMemoryStorage(context.Background())
+	shortener := usecase.NewShortenerService(storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{Policy: engine})
+	keys, _ := middleware.NewKeyring([]string{"test-secret-key"})
+	apiKeys := usecase.NewAPIKeyService(service.NewMemoryAPIKeyStore())
+	r := Router(config.Config{BaseURL: "http://localhost:8080"}, shortener, keys, apiKeys, nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://login.phish.example/")))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected blocked destination to get %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://newly-bad.example/")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	shortKey := strings.TrimPrefix(w.Body.String(), "http://localhost:8080/")
+
+	if err := os.WriteFile(path, []byte(`{"rules": [{"action": "deny", "domain": "newly-bad.example"}]}`), 0644); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	if err := engine.Reload(); err != nil {
+		t.Fatalf("failed to reload policy: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+shortKey, nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected redirect to newly blocked destination to get %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+// stubStorage подменяет сохранение и чтение ссылок заданными ошибками
+type stubStorage struct {
+	service.Storage
+	saveErr error
+	getErr  error
+}
+
+func (s *stubStorage) SaveShortURL(ctx context.Context, model models.URL) error {
+	return s.saveErr
+}
+
+func (s *stubStorage) GetLongURL(ctx context.Context, short string) (string, error) {
+	return "", s.getErr
+}
+
+func TestStorageErrors(t *testing.T) {
+	logger.Initialize()
+
+	outage := fmt.Errorf("failed to save URL: %w: connection refused", service.ErrUnavailable)
+	tests := []struct {
+		name           string
+		storage        *stubStorage
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Save during outage",
+			storage:        &stubStorage{saveErr: outage},
+			method:         http.MethodPost,
+			path:           "/",
+			body:           "https://example.com",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Unexpected save error",
+			storage:        &stubStorage{saveErr: errors.New("disk is full")},
+			method:         http.MethodPost,
+			path:           "/",
+			body:           "https://example.com",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Duplicate original URL",
+			storage:        &stubStorage{saveErr: &service.DuplicateURLError{ShortURL: "existing"}},
+			method:         http.MethodPost,
+			path:           "/",
+			body:           "https://example.com",
+			expectedStatus: http.StatusConflict,
+			expectedBody:   "http://localhost:8080/existing",
+		},
+		{
+			name:           "Redirect during outage",
+			storage:        &stubStorage{getErr: outage},
+			method:         http.MethodGet,
+			path:           "/abc",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Redirect to deleted URL",
+			storage:        &stubStorage{getErr: service.ErrGone},
+			method:         http.MethodGet,
+			path:           "/abc",
+			expectedStatus: http.StatusGone,
+		},
+	}
+
+	keys, _ := middleware.NewKeyring([]string{"test-secret-key"})
+	apiKeys := usecase.NewAPIKeyService(service.NewMemoryAPIKeyStore())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shortener := usecase.NewShortenerService(tt.storage, service.NewMemoryClickStore(), nil, usecase.ShortenerOptions{})
+			r := Router(config.Config{BaseURL: "http://localhost:8080"}, shortener, keys, apiKeys, nil)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -2,9 +2,6 @@ package middleware
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
@@ -17,95 +14,188 @@ import (
 type contextKey string
 
 const UserIDContextKey contextKey = "userID"
+
+// apiKeyAuthContextKey отмечает запросы, пользователь которых определён по X-API-Key
+const apiKeyAuthContextKey contextKey = "apiKeyAuth"
 const cookieName = "user_id"
 
-func Authenticate(secretKey string) func(http.Handler) http.Handler {
+// APIKeyHeader — заголовок с ключом доступа пользователя
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyResolver находит владельца ключа доступа
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, key string) (string, bool, error)
+}
+
+// Authenticate определяет пользователя по заголовку X-API-Key, заголовку
+// Authorization: Bearer или по подписанной куке. Без заголовка кука выдаётся и проверяется как
+// раньше; куки, подписанные неосновным ключом, выпускаются заново.
+// Недействительный ключ или токен отклоняется с 401. При secure кука
+// передаётся только по HTTPS.
+func Authenticate(keys *Keyring, apiKeys APIKeyResolver, secure bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := r.Header.Get(APIKeyHeader); key != "" && apiKeys != nil {
+				userID, found, err := apiKeys.ResolveAPIKey(r.Context(), key)
+				if err != nil {
+					logger.FromContext(r.Context()).Errorf("Failed to resolve API key: %v", err)
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				if !found {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				ctx := context.WithValue(WithUserID(r.Context(), userID), apiKeyAuthContextKey, true)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			if header := r.Header.Get("Authorization"); header != "" {
+				token, ok := BearerToken(header)
+				if !ok {
+					rejectBearer(w)
+					return
+				}
+				userID, err := ParseJWT(token, keys)
+				if err != nil {
+					logger.FromContext(r.Context()).Debugf("Invalid bearer token: %v", err)
+					rejectBearer(w)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(WithUserID(r.Context(), userID)))
+				return
+			}
+
 			var userID string
 
 			cookie, err := r.Cookie(cookieName)
 			if err != nil {
 				// Куки нет, создаем нового пользователя
 				userID = generateUserID()
-				setAuthCookie(w, userID, secretKey)
-				logger.Sugar.Debugf("Created new user ID: %s", userID)
+				setAuthCookie(w, userID, keys, secure)
+				logger.FromContext(r.Context()).Debugf("Created new user ID: %s", userID)
 			} else {
 				// Проверяем подпись куки
-				userID, err = validateCookie(cookie, secretKey)
-				if err != nil {
+				var stale bool
+				userID, stale, err = ParseUserToken(cookie.Value, keys)
+				switch {
+				case err != nil:
 					// Кука невалидна, создаем нового пользователя
 					userID = generateUserID()
-					setAuthCookie(w, userID, secretKey)
-					logger.Sugar.Debugf("Invalid cookie, created new user ID: %s", userID)
-				} else {
-					logger.Sugar.Debugf("Authenticated user ID: %s", userID)
+					setAuthCookie(w, userID, keys, secure)
+					logger.FromContext(r.Context()).Debugf("Invalid cookie, created new user ID: %s", userID)
+				case stale:
+					// Кука подписана старым ключом, переподписываем основным
+					setAuthCookie(w, userID, keys, secure)
+					logger.FromContext(r.Context()).Debugf("Re-issued cookie for user ID: %s", userID)
+				default:
+					logger.FromContext(r.Context()).Debugf("Authenticated user ID: %s", userID)
 				}
 			}
 
 			// Добавляем userID в контекст
-			ctx := context.WithValue(r.Context(), UserIDContextKey, userID)
+			ctx := WithUserID(r.Context(), userID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// RejectAPIKey отклоняет с 403 запросы, аутентифицированные ключом доступа.
+// Ставится на маршруты, выпускающие новые учётные данные: иначе утёкший ключ
+// можно обменять на токен или другой ключ, которые переживут его отзыв.
+func RejectAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if AuthenticatedByAPIKey(r.Context()) {
+			http.Error(w, "API keys cannot issue new credentials", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthenticatedByAPIKey сообщает, что пользователь запроса определён по ключу доступа
+func AuthenticatedByAPIKey(ctx context.Context) bool {
+	byKey, _ := ctx.Value(apiKeyAuthContextKey).(bool)
+	return byKey
+}
+
 // generateUserID создает новый UUID для пользователя
 func generateUserID() string {
 	return uuid.New().String()
 }
 
-// signData создает подпись для данных
-func signData(data, key string) string {
-	h := hmac.New(sha256.New, []byte(key))
-	h.Write([]byte(data))
-	return hex.EncodeToString(h.Sum(nil))
-}
-
 // setAuthCookie устанавливает аутентификационную куку
-func setAuthCookie(w http.ResponseWriter, userID, secretKey string) {
-	signature := signData(userID, secretKey)
-	value := userID + "." + signature
-
+func setAuthCookie(w http.ResponseWriter, userID string, keys *Keyring, secure bool) {
 	cookie := &http.Cookie{
 		Name:     cookieName,
-		Value:    value,
+		Value:    IssueUserToken(userID, keys),
 		Path:     "/",
 		Expires:  time.Now().Add(365 * 24 * time.Hour), // 1 год
 		HttpOnly: true,
+		Secure:   secure,
 		SameSite: http.SameSiteLaxMode,
 	}
 
 	http.SetCookie(w, cookie)
 }
 
-// validateCookie проверяет валидность куки
-func validateCookie(cookie *http.Cookie, secretKey string) (string, error) {
-	if cookie.Value == "" {
-		return "", errors.New("empty cookie value")
+// NewUserToken создаёт нового пользователя и подписанный токен для него
+func NewUserToken(keys *Keyring) (userID, token string) {
+	userID = generateUserID()
+	return userID, IssueUserToken(userID, keys)
+}
+
+// IssueUserToken подписывает идентификатор пользователя основным ключом.
+// Формат токена: userID.keyID.signature
+func IssueUserToken(userID string, keys *Keyring) string {
+	keyID, signature := keys.sign(userID)
+	return userID + "." + keyID + "." + signature
+}
+
+// ParseUserToken проверяет подпись токена и возвращает идентификатор
+// пользователя. stale сообщает, что токен подписан неосновным ключом или
+// выдан в прежнем формате userID.signature без идентификатора ключа.
+func ParseUserToken(token string, keys *Keyring) (userID string, stale bool, err error) {
+	if token == "" {
+		return "", false, errors.New("empty token")
 	}
 
-	// Разделяем userID и подпись
-	parts := strings.Split(cookie.Value, ".")
-	if len(parts) != 2 {
-		return "", errors.New("invalid cookie format")
+	// Разделяем userID, идентификатор ключа и подпись
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 && len(parts) != 3 {
+		return "", false, errors.New("invalid token format")
 	}
 
-	userID := parts[0]
-	signature := parts[1]
+	userID = parts[0]
 
 	// Проверяем что userID - валидный UUID
 	if _, err := uuid.Parse(userID); err != nil {
-		return "", fmt.Errorf("invalid user ID: %w", err)
+		return "", false, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	// Куки прежнего формата принимаем, чтобы не разлогинить пользователей,
+	// и сразу переподписываем
+	if len(parts) == 2 {
+		if err := keys.verifyLegacy(userID, parts[1]); err != nil {
+			return "", false, err
+		}
+		return userID, true, nil
 	}
 
 	// Проверяем подпись
-	expectedSignature := signData(userID, secretKey)
-	if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
-		return "", errors.New("invalid signature")
+	stale, err = keys.verify(userID, parts[1], parts[2])
+	if err != nil {
+		return "", false, err
 	}
 
-	return userID, nil
+	return userID, stale, nil
+}
+
+// WithUserID кладёт идентификатор пользователя в контекст запроса
+func WithUserID(ctx context.Context, userID string) context.Context {
+	ctx = logger.WithUserID(ctx, userID)
+	return context.WithValue(ctx, UserIDContextKey, userID)
 }
 
 // GetUserIDFromContext извлекает userID из контекста
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+)
+
+func TestAuthenticateKeyRotation(t *testing.T) {
+	logger.Initialize()
+
+	oldKeys, _ := NewKeyring([]string{"old-key"})
+	rotated, _ := NewKeyring([]string{"new-key", "old-key"})
+	unrelated, _ := NewKeyring([]string{"other-key"})
+
+	oldToken := IssueUserToken("5b1e4c1e-3f5d-4a8e-9a56-0c6f4f0d8a11", oldKeys)
+	// Кука в формате до ротации ключей: userID.hmac(userID)
+	legacyToken := "5b1e4c1e-3f5d-4a8e-9a56-0c6f4f0d8a11." + signWith(oldKeys.primary, "5b1e4c1e-3f5d-4a8e-9a56-0c6f4f0d8a11")
+
+	tests := []struct {
+		name        string
+		keys        *Keyring
+		token       string
+		wantSameID  bool
+		wantReissue bool
+	}{
+		{name: "signed with primary key", keys: oldKeys, token: oldToken, wantSameID: true},
+		{name: "signed with previous key", keys: rotated, token: oldToken, wantSameID: true, wantReissue: true},
+		{name: "signed with unknown key", keys: unrelated, token: oldToken, wantReissue: true},
+		{name: "legacy format", keys: oldKeys, token: legacyToken, wantSameID: true, wantReissue: true},
+		{name: "legacy format after rotation", keys: rotated, token: legacyToken, wantSameID: true, wantReissue: true},
+		{name: "legacy format with unknown key", keys: unrelated, token: legacyToken, wantReissue: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userID string
+			handler := Authenticate(tt.keys, nil, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID, _ = GetUserIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: cookieName, Value: tt.token})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if got := userID == "5b1e4c1e-3f5d-4a8e-9a56-0c6f4f0d8a11"; got != tt.wantSameID {
+				t.Errorf("expected same user ID: %v, got user %s", tt.wantSameID, userID)
+			}
+
+			cookies := w.Result().Cookies()
+			if reissued := len(cookies) > 0; reissued != tt.wantReissue {
+				t.Fatalf("expected cookie re-issue: %v, got %v", tt.wantReissue, cookies)
+			}
+			if tt.wantReissue {
+				id, stale, err := ParseUserToken(cookies[0].Value, tt.keys)
+				if err != nil || stale || id != userID {
+					t.Errorf("expected a fresh token for %s signed with the primary key, got %s (stale=%v, err=%v)", userID, id, stale, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticateBearer(t *testing.T) {
+	logger.Initialize()
+
+	keys, _ := NewKeyring([]string{"test-key"})
+	valid, _, _ := IssueJWT("5b1e4c1e-3f5d-4a8e-9a56-0c6f4f0d8a11", keys, time.Hour)
+	expired, _, _ := IssueJWT("5b1e4c1e-3f5d-4a8e-9a56-0c6f4f0d8a11", keys, -time.Hour)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{name: "valid token", header: "Bearer " + valid, wantStatus: http.StatusOK},
+		{name: "expired token", header: "Bearer " + expired, wantStatus: http.StatusUnauthorized},
+		{name: "malformed token", header: "Bearer not-a-jwt", wantStatus: http.StatusUnauthorized},
+		{name: "other scheme", header: "Basic dXNlcjpwYXNz", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userID string
+			handler := Authenticate(keys, nil, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID, _ = GetUserIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", tt.header)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusOK && userID != "5b1e4c1e-3f5d-4a8e-9a56-0c6f4f0d8a11" {
+				t.Errorf("expected user from token, got %q", userID)
+			}
+			if len(w.Result().Cookies()) != 0 {
+				t.Error("expected no cookie for bearer requests")
+			}
+		})
+	}
+}
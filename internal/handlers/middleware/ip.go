@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const clientIPContextKey contextKey = "clientIP"
+
+// RealIP определяет адрес клиента и сохраняет его в контексте для ClientIP.
+// Заголовкам X-Real-IP и X-Forwarded-For верим, только если соединение
+// пришло от прокси из proxies: иначе клиент подставил бы в них любой адрес.
+func RealIP(proxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, proxies)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPContextKey, ip)))
+		})
+	}
+}
+
+// ClientIP возвращает адрес, определённый RealIP, а без него — адрес соединения
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func resolveClientIP(r *http.Request, proxies []*net.IPNet) string {
+	peer := remoteIP(r)
+	if !trustedProxy(peer, proxies) {
+		return peer
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	// Адреса справа добавлены нашими прокси; первый недоверенный справа и
+	// есть клиент, всё левее него мог прислать сам клиент
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !trustedProxy(ip.String(), proxies) {
+			return ip.String()
+		}
+	}
+
+	return peer
+}
+
+func trustedProxy(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
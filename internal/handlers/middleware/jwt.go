@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// bearerPrefix — схема заголовка Authorization для JWT
+const bearerPrefix = "Bearer "
+
+// IssueJWT выпускает токен для userID, подписанный основным ключом.
+// Идентификатор ключа записывается в заголовок kid для проверки после ротации.
+func IssueJWT(userID string, keys *Keyring, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   userID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	token.Header["kid"] = keys.primary.id
+
+	signed, err := token.SignedString(keys.primary.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseJWT проверяет подпись и срок действия токена и возвращает идентификатор пользователя
+func ParseJWT(token string, keys *Keyring) (string, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		keyID, _ := t.Header["kid"].(string)
+		key, ok := keys.byID[keyID]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		return key.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return "", fmt.Errorf("invalid user ID: %w", err)
+	}
+	return claims.Subject, nil
+}
+
+// BearerToken извлекает токен из значения заголовка Authorization
+func BearerToken(header string) (string, bool) {
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(header[len(bearerPrefix):])
+	return token, token != ""
+}
+
+// rejectBearer отвечает 401 на недействительный токен
+func rejectBearer(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// keyIDLength — длина идентификатора ключа в символах hex
+const keyIDLength = 8
+
+// ErrNoSecretKeys возвращается, если для подписи не задано ни одного ключа
+var ErrNoSecretKeys = errors.New("no secret keys configured")
+
+// signingKey — ключ подписи и его идентификатор, записываемый в токен
+type signingKey struct {
+	id     string
+	secret []byte
+}
+
+// Keyring хранит действующие ключи подписи. Новые токены подписываются
+// основным ключом, остальные ключи только проверяют ранее выданные токены.
+type Keyring struct {
+	primary signingKey
+	byID    map[string]signingKey
+}
+
+// NewKeyring создаёт набор ключей; первый из secrets становится основным.
+// Идентификатор ключа выводится из его хеша, поэтому не зависит от порядка.
+func NewKeyring(secrets []string) (*Keyring, error) {
+	if len(secrets) == 0 {
+		return nil, ErrNoSecretKeys
+	}
+
+	k := &Keyring{byID: make(map[string]signingKey, len(secrets))}
+	for i, secret := range secrets {
+		if secret == "" {
+			return nil, errors.New("secret key cannot be empty")
+		}
+		sum := sha256.Sum256([]byte(secret))
+		key := signingKey{id: hex.EncodeToString(sum[:])[:keyIDLength], secret: []byte(secret)}
+		if i == 0 {
+			k.primary = key
+		}
+		k.byID[key.id] = key
+	}
+
+	return k, nil
+}
+
+// sign подписывает идентификатор пользователя основным ключом.
+// Подпись покрывает и идентификатор ключа, чтобы его нельзя было подменить.
+func (k *Keyring) sign(userID string) (keyID, signature string) {
+	return k.primary.id, signWith(k.primary, userID+"."+k.primary.id)
+}
+
+// verify проверяет подпись ключом keyID. stale означает, что ключ
+// действующий, но не основной, и токен стоит выпустить заново.
+func (k *Keyring) verify(userID, keyID, signature string) (stale bool, err error) {
+	key, ok := k.byID[keyID]
+	if !ok {
+		return false, errors.New("unknown signing key")
+	}
+	if !hmac.Equal([]byte(signature), []byte(signWith(key, userID+"."+key.id))) {
+		return false, errors.New("invalid signature")
+	}
+	return key.id != k.primary.id, nil
+}
+
+// verifyLegacy проверяет подпись токена прежнего формата, который подписывал
+// только идентификатор пользователя единственным ключом. Проверяются все
+// ключи: после ротации прежний ключ перестаёт быть основным.
+func (k *Keyring) verifyLegacy(userID, signature string) error {
+	for _, key := range k.byID {
+		if hmac.Equal([]byte(signature), []byte(signWith(key, userID))) {
+			return nil
+		}
+	}
+	return errors.New("invalid signature")
+}
+
+func signWith(key signingKey, data string) string {
+	h := hmac.New(sha256.New, key.secret)
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
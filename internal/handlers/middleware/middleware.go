@@ -4,10 +4,13 @@ import (
 	"compress/gzip"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/metrics"
 )
 
 type (
@@ -42,11 +45,16 @@ func WithLogging(h http.Handler) http.Handler {
 			ResponseWriter: w,
 			responseData:   responseData,
 		}
-		h.ServeHTTP(&lw, r)
+		ctx, accessUser := logger.WithAccessUser(r.Context())
+		h.ServeHTTP(&lw, r.WithContext(ctx))
 
 		duration := time.Since(start)
 
-		logger.Sugar.Infoln(
+		log := logger.FromContext(r.Context())
+		if userID := accessUser(); userID != "" {
+			log = log.With("user_id", userID)
+		}
+		log.Infoln(
 			"uri", r.RequestURI,
 			"method", r.Method,
 			"duration", duration,
@@ -56,6 +64,33 @@ func WithLogging(h http.Handler) http.Handler {
 	})
 }
 
+// WithMetrics считает запросы и время их обработки по шаблону маршрута chi,
+// чтобы параметры пути не порождали отдельных серий
+func WithMetrics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		responseData := &responseData{}
+		lw := loggingResponseWriter{
+			ResponseWriter: w,
+			responseData:   responseData,
+		}
+		h.ServeHTTP(&lw, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := responseData.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
 // Список поддерживаемых типов контента для сжатия.
 var supportedContentTypes = []string{"application/json", "text/html"}
 
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/metrics"
+	"github.com/linarium/shortener/internal/ratelimit"
+)
+
+// RateLimit ограничивает запросы класса class отдельными корзинами для
+// пользователя из контекста и для адреса клиента: новые куки не обходят лимит
+// по адресу, а общий адрес не отнимает лимит у пользователей с ключами.
+// Адрес берётся из ClientIP, поэтому подделать его заголовками можно только
+// за доверенным прокси. Должен стоять после Authenticate. Если хранилище недоступно, запрос
+// пропускается, чтобы сбой счётчиков не останавливал сервис.
+func RateLimit(store ratelimit.Store, class string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if store == nil || !limit.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys := []string{class + ":ip:" + ClientIP(r)}
+			if userID, ok := GetUserIDFromContext(r.Context()); ok && userID != "" {
+				keys = append(keys, class+":user:"+userID)
+			}
+
+			result, err := ratelimit.TakeAll(r.Context(), store, limit, keys...)
+			if err != nil {
+				logger.FromContext(r.Context()).Errorf("Rate limit check failed: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w, result)
+			if !result.Allowed {
+				metrics.RateLimited.WithLabelValues(class).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(max(result.Remaining, 0)))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+// ceilSeconds округляет d вверх до целых секунд, но не меньше одной
+func ceilSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	logger.Initialize()
+
+	limit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+	handler := RateLimit(ratelimit.NewMemoryStore(), ratelimit.ClassCreate, limit)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(ip, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = ip + ":40000"
+		req = req.WithContext(WithUserID(req.Context(), userID))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("10.0.0.1", "user-1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, w.Code)
+		}
+	}
+
+	w := request("10.0.0.1", "user-1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" {
+		t.Errorf("expected Retry-After 30, got %q", w.Header().Get("Retry-After"))
+	}
+	if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("unexpected RateLimit headers: %v", w.Header())
+	}
+
+	if w := request("10.0.0.1", "user-2"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("new user from the same address should hit the address limit, got %d", w.Code)
+	}
+	if w := request("10.0.0.2", "user-1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("same user from another address should hit the user limit, got %d", w.Code)
+	}
+
+	// Без доверенных прокси заголовки не меняют адрес клиента
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.RemoteAddr = "10.0.0.1:40000"
+	req.Header.Set("X-Forwarded-For", "192.0.2.7")
+	req = req.WithContext(WithUserID(req.Context(), "user-4"))
+	spoofed := httptest.NewRecorder()
+	RealIP(nil)(handler).ServeHTTP(spoofed, req)
+	if spoofed.Code != http.StatusTooManyRequests {
+		t.Errorf("forged X-Forwarded-For should not bypass the address limit, got %d", spoofed.Code)
+	}
+
+	if w := request("10.0.0.3", "user-3"); w.Code != http.StatusOK {
+		t.Errorf("unrelated client should not be limited, got %d", w.Code)
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.1.0.0/16")
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{name: "direct client", remote: "192.0.2.1:5000", want: "192.0.2.1"},
+		{
+			name:    "untrusted peer headers are ignored",
+			remote:  "192.0.2.1:5000",
+			headers: map[string]string{"X-Real-IP": "198.51.100.1", "X-Forwarded-For": "198.51.100.2"},
+			want:    "192.0.2.1",
+		},
+		{
+			name:    "trusted proxy X-Real-IP",
+			remote:  "10.1.0.5:5000",
+			headers: map[string]string{"X-Real-IP": "198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "rightmost untrusted forwarded address",
+			remote:  "10.1.0.5:5000",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.2, 10.1.0.7"},
+			want:    "198.51.100.2",
+		},
+		{name: "trusted proxy without headers", remote: "10.1.0.5:5000", want: "10.1.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP([]*net.IPNet{proxies})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/linarium/shortener/internal/logger"
+)
+
+// RequestIDHeader — заголовок с идентификатором запроса
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничивает длину принятого от клиента идентификатора
+const maxRequestIDLength = 128
+
+// RequestID берёт идентификатор запроса из X-Request-ID или создаёт новый,
+// возвращает его в ответе и кладёт в контекст для логгера
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := ResolveRequestID(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// ResolveRequestID возвращает id, если он пригоден для журнала, иначе новый UUID
+func ResolveRequestID(id string) string {
+	if !validRequestID(id) {
+		return uuid.NewString()
+	}
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linarium/shortener/internal/logger"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{name: "honors client ID", incoming: "req-42", wantSame: true},
+		{name: "generates when missing"},
+		{name: "replaces ID with spaces", incoming: "bad id"},
+		{name: "replaces too long ID", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = logger.RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			echoed := w.Header().Get(RequestIDHeader)
+			if echoed == "" || echoed != fromContext {
+				t.Fatalf("response ID %q does not match context ID %q", echoed, fromContext)
+			}
+			if (echoed == tt.incoming) != tt.wantSame {
+				t.Errorf("unexpected request ID %q for incoming %q", echoed, tt.incoming)
+			}
+		})
+	}
+}
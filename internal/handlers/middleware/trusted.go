@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedSubnet пропускает только запросы, адрес из X-Real-IP которых входит
+// в subnet. Без настроенной подсети доступ закрыт для всех.
+func TrustedSubnet(subnet *net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+			if subnet == nil || ip == nil || !subnet.Contains(ip) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,30 +2,62 @@ package handlers
 
 import (
 	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/metrics"
+	"github.com/linarium/shortener/internal/ratelimit"
 	"github.com/linarium/shortener/internal/usecase"
+	"net"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/linarium/shortener/internal/config"
 )
 
-func Router(cfg config.Config, shortener usecase.Repository) chi.Router {
+// Router собирает HTTP API. Если limiter равен nil, лимиты запросов не применяются.
+func Router(cfg config.Config, shortener usecase.Repository, keys *middleware.Keyring, apiKeys usecase.APIKeys, limiter ratelimit.Store) chi.Router {
 	r := chi.NewRouter()
 
 	handler := NewURLHandler(cfg, shortener)
+	tokens := NewTokenHandler(keys, cfg.JWTTTL)
+	apiKeyHandler := NewAPIKeyHandler(apiKeys)
 
-	r.Use(middleware.Authenticate(cfg.SecretKey))
+	limits := cfg.RateLimits()
+	limit := func(class string) func(http.Handler) http.Handler {
+		return middleware.RateLimit(limiter, class, limits[class])
+	}
+
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP(cfg.TrustedProxyNets()))
+	r.Use(middleware.WithMetrics)
 	r.Use(middleware.WithLogging)
 
-	r.Get("/{id}", middleware.Compressor(handler.getURL))
-	r.Get("/ping", middleware.Compressor(handler.PingDB))
+	// Метрики не требуют аутентификации, чтобы сборщик не получал куки
+	r.Handle("/metrics", metrics.Handler())
 
 	r.Group(func(r chi.Router) {
-		r.Post("/", middleware.Compressor(handler.createShortURL))
-		r.Post("/api/shorten", middleware.Compressor(handler.createJSONShortURL))
-		r.Post("/api/shorten/batch", handler.ShortenBatch)
+		r.Use(middleware.Authenticate(keys, apiKeys, cfg.EnableHTTPS))
+
+		r.With(limit(ratelimit.ClassRedirect)).Get("/{id}", middleware.Compressor(handler.getURL))
+		r.Get("/ping", middleware.Compressor(handler.PingDB))
+
+		r.With(limit(ratelimit.ClassCreate)).Post("/", middleware.Compressor(handler.createShortURL))
+		r.With(limit(ratelimit.ClassCreate)).Post("/api/shorten", middleware.Compressor(handler.createJSONShortURL))
+		r.With(limit(ratelimit.ClassBatch)).Post("/api/shorten/batch", handler.ShortenBatch)
 		r.Get("/api/user/urls", handler.GetURLs)
-		r.Delete("/api/user/urls", handler.DeleteURLs)
+		r.Get("/api/user/urls/{id}/stats", handler.GetURLStats)
+		r.With(limit(ratelimit.ClassDelete)).Delete("/api/user/urls", handler.DeleteURLs)
+		r.With(middleware.RejectAPIKey).Post("/api/user/token", tokens.IssueToken)
+		r.With(middleware.RejectAPIKey).Post("/api/user/keys", apiKeyHandler.CreateAPIKey)
+		r.Get("/api/user/keys", apiKeyHandler.ListAPIKeys)
+		r.Delete("/api/user/keys/{id}", apiKeyHandler.RevokeAPIKey)
+
+		// Служебные маршруты доступны только из доверенной подсети
+		_, trusted, _ := net.ParseCIDR(cfg.TrustedSubnet)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.TrustedSubnet(trusted))
+			r.Get("/api/internal/stats", handler.GetStats)
+			r.Post("/api/internal/compact", handler.CompactStorage)
+			r.Get("/api/internal/deletions", handler.DeletionStats)
+		})
 	})
 
 	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
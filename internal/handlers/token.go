@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/linarium/shortener/internal/handlers/middleware"
+	"github.com/linarium/shortener/internal/logger"
+)
+
+type tokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TokenHandler обменивает текущую личность пользователя (куку или токен)
+// на JWT для API-клиентов
+type TokenHandler struct {
+	keys *middleware.Keyring
+	ttl  time.Duration
+}
+
+func NewTokenHandler(keys *middleware.Keyring, ttl time.Duration) *TokenHandler {
+	return &TokenHandler{keys: keys, ttl: ttl}
+}
+
+func (h *TokenHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	token, expiresAt, err := middleware.IssueJWT(userID, h.keys, h.ttl)
+	if err != nil {
+		logger.FromContext(r.Context()).Errorf("Failed to issue token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(tokenResponse{Token: token, ExpiresAt: expiresAt.UTC()}); err != nil {
+		logger.FromContext(r.Context()).Errorf("failed to encode response: %v", err)
+	}
+}
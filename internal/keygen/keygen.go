@@ -0,0 +1,111 @@
+// Package keygen генерирует случайные короткие ключи заданной длины из
+// заданного алфавита.
+package keygen
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Встроенные алфавиты
+const (
+	// Base64URL — исторический алфавит сервиса
+	Base64URL = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	// Base62 — только буквы и цифры
+	Base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// Base58 — без похожих символов 0, O, I и l, удобен для ручного ввода
+	Base58 = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+)
+
+// Ограничения на длину ключа
+const (
+	MinLength = 4
+	MaxLength = 64
+)
+
+// ErrInvalidAlphabet возвращается для алфавита, непригодного для ключей
+var ErrInvalidAlphabet = errors.New("invalid key alphabet")
+
+var namedAlphabets = map[string]string{
+	"base64url": Base64URL,
+	"base62":    Base62,
+	"base58":    Base58,
+}
+
+// Generator создаёт ключи фиксированной длины с равномерным распределением символов
+type Generator struct {
+	alphabet string
+	length   int
+}
+
+// New создаёт генератор. alphabet — имя встроенного алфавита (base64url,
+// base62, base58) или сами символы: латинские буквы, цифры, '-' и '_'.
+func New(alphabet string, length int) (*Generator, error) {
+	if named, ok := namedAlphabets[strings.ToLower(alphabet)]; ok {
+		alphabet = named
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	if length < MinLength || length > MaxLength {
+		return nil, fmt.Errorf("key length must be between %d and %d", MinLength, MaxLength)
+	}
+	return &Generator{alphabet: alphabet, length: length}, nil
+}
+
+// Default возвращает генератор, совместимый с прежними ключами: 8 символов base64url
+func Default() *Generator {
+	return &Generator{alphabet: Base64URL, length: 8}
+}
+
+// Generate возвращает новый случайный ключ
+func (g *Generator) Generate() string {
+	n := len(g.alphabet)
+	// Байты не меньше limit отбрасываются, иначе первые символы алфавита
+	// выпадали бы чаще остальных
+	limit := 256 - 256%n
+
+	key := make([]byte, 0, g.length)
+	buf := make([]byte, g.length*2)
+	for len(key) < g.length {
+		// crypto/rand.Read не возвращает ошибок
+		_, _ = rand.Read(buf)
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			key = append(key, g.alphabet[int(b)%n])
+			if len(key) == g.length {
+				break
+			}
+		}
+	}
+	return string(key)
+}
+
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		return fmt.Errorf("%w: must contain from 2 to 256 characters", ErrInvalidAlphabet)
+	}
+
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, r := range alphabet {
+		if !isKeyRune(r) {
+			return fmt.Errorf("%w: only latin letters, digits, '-' and '_' are allowed", ErrInvalidAlphabet)
+		}
+		if _, dup := seen[r]; dup {
+			return fmt.Errorf("%w: character %q is repeated", ErrInvalidAlphabet, r)
+		}
+		seen[r] = struct{}{}
+	}
+	return nil
+}
+
+func isKeyRune(r rune) bool {
+	return r >= 'a' && r <= 'z' ||
+		r >= 'A' && r <= 'Z' ||
+		r >= '0' && r <= '9' ||
+		r == '-' || r == '_'
+}
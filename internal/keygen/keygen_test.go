@@ -0,0 +1,65 @@
+package keygen
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		length   int
+		chars    string
+	}{
+		{name: "base64url", alphabet: "base64url", length: 8, chars: Base64URL},
+		{name: "base58 by name", alphabet: "Base58", length: 12, chars: Base58},
+		{name: "custom alphabet", alphabet: "abc", length: 6, chars: "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New(tt.alphabet, tt.length)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i := 0; i < 100; i++ {
+				key := g.Generate()
+				if len(key) != tt.length {
+					t.Fatalf("expected length %d, got %q", tt.length, key)
+				}
+				if strings.Trim(key, tt.chars) != "" {
+					t.Fatalf("key %q has characters outside of %q", key, tt.chars)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		length   int
+		wantErr  error
+	}{
+		{name: "single character", alphabet: "a", length: 8, wantErr: ErrInvalidAlphabet},
+		{name: "repeated character", alphabet: "abca", length: 8, wantErr: ErrInvalidAlphabet},
+		{name: "unsafe character", alphabet: "ab/", length: 8, wantErr: ErrInvalidAlphabet},
+		{name: "too short", alphabet: "base62", length: MinLength - 1},
+		{name: "too long", alphabet: "base62", length: MaxLength + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.alphabet, tt.length)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
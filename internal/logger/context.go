@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// accessUserKey — ключ ячейки, в которую попадает пользователь запроса для
+// журнала доступа
+type accessUserKey struct{}
+
+// requestFields — поля, которые добавляются ко всем записям журнала запроса
+type requestFields struct {
+	requestID string
+	userID    string
+}
+
+// WithRequestID начинает набор полей запроса с идентификатором requestID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestFields{requestID: requestID})
+}
+
+// WithUserID возвращает контекст, к полям запроса которого добавлен
+// идентификатор пользователя. Поля родительского контекста не меняются.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	fields := requestFields{userID: userID}
+	if parent, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		fields.requestID = parent.requestID
+	}
+	if user, ok := ctx.Value(accessUserKey{}).(*atomic.Pointer[string]); ok {
+		user.Store(&userID)
+	}
+	return context.WithValue(ctx, contextKey{}, &fields)
+}
+
+// WithAccessUser заводит ячейку, в которую WithUserID запишет пользователя
+// запроса, и возвращает функцию для её чтения. Журнал доступа пишется
+// снаружи аутентификации и иначе не увидел бы пользователя из дочернего
+// контекста.
+func WithAccessUser(ctx context.Context) (context.Context, func() string) {
+	user := new(atomic.Pointer[string])
+	read := func() string {
+		if userID := user.Load(); userID != nil {
+			return *userID
+		}
+		return ""
+	}
+	return context.WithValue(ctx, accessUserKey{}, user), read
+}
+
+// RequestIDFromContext возвращает идентификатор запроса или пустую строку
+func RequestIDFromContext(ctx context.Context) string {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		return fields.requestID
+	}
+	return ""
+}
+
+// FromContext возвращает логгер с идентификаторами запроса и пользователя из ctx
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	fields, ok := ctx.Value(contextKey{}).(*requestFields)
+	if !ok {
+		return Sugar
+	}
+
+	var args []any
+	if fields.requestID != "" {
+		args = append(args, "request_id", fields.requestID)
+	}
+	if fields.userID != "" {
+		args = append(args, "user_id", fields.userID)
+	}
+	return Sugar.With(args...)
+}
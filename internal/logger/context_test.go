@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWithUserIDKeepsParentContext(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	Sugar = zap.New(core).Sugar()
+	t.Cleanup(Initialize)
+
+	ctx, accessUser := WithAccessUser(WithRequestID(context.Background(), "req-1"))
+	child := WithUserID(ctx, "user-1")
+
+	FromContext(ctx).Info("parent")
+	FromContext(child).Info("child")
+
+	entries := logs.AllUntimed()
+	if parent := entries[0].ContextMap(); parent["request_id"] != "req-1" || parent["user_id"] != nil {
+		t.Errorf("parent context must stay without a user, got %v", parent)
+	}
+	if fields := entries[1].ContextMap(); fields["request_id"] != "req-1" || fields["user_id"] != "user-1" {
+		t.Errorf("child context must carry request and user IDs, got %v", fields)
+	}
+	if got := accessUser(); got != "user-1" {
+		t.Errorf("expected access log to see user-1, got %q", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Package metrics собирает метрики сервиса в формате Prometheus.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/linarium/shortener/internal/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+var (
+	// HTTPRequests считает запросы по шаблону маршрута, методу и статусу
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	// HTTPDuration — время обработки запросов по шаблону маршрута и методу
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// Shortened считает созданные короткие ссылки
+	Shortened = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "links_shortened_total",
+		Help:      "Short links created.",
+	})
+
+	// ShortenConflicts считает попытки сократить уже сокращённую ссылку
+	ShortenConflicts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shorten_conflicts_total",
+		Help:      "Shorten requests answered with an existing link.",
+	})
+
+	// Redirects считает переходы по коротким ссылкам
+	Redirects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Redirects to original URLs.",
+	})
+
+	// Gone считает обращения к удалённым и истёкшим ссылкам
+	Gone = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gone_total",
+		Help:      "Requests for deleted or expired links.",
+	})
+
+	// KeyCollisions — сгенерированные короткие ключи, оказавшиеся занятыми
+	KeyCollisions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "short_key_collisions_total",
+		Help:      "Generated short keys that were already taken.",
+	})
+
+	// RateLimited — запросы, отклонённые лимитом, по классу маршрута
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by rate limiting, by route class.",
+	}, []string{"class"})
+
+	// StorageDuration — время операций хранилища по операции и результату
+	StorageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Storage operation latency by operation and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "result"})
+)
+
+// Handler отдаёт метрики в текстовом формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDBPool публикует состояние пула соединений db
+func RegisterDBPool(db *sql.DB) error {
+	if db == nil {
+		return errors.New("connection pool is not available")
+	}
+	return prometheus.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// ClickQueue — состояние очереди записи переходов
+type ClickQueue interface {
+	Dropped() int64
+	Failed() int64
+	QueueDepth() int
+}
+
+// RegisterClickQueue публикует счётчики отброшенных и не записанных
+// переходов и текущую глубину очереди
+func RegisterClickQueue(queue ClickQueue) error {
+	clickCollectors := []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "clicks_dropped_total",
+			Help:      "Clicks dropped because the ingestion queue was full.",
+		}, func() float64 { return float64(queue.Dropped()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "clicks_failed_total",
+			Help:      "Clicks that could not be written to the click store.",
+		}, func() float64 { return float64(queue.Failed()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "clicks_queue_depth",
+			Help:      "Clicks waiting in the ingestion queue.",
+		}, func() float64 { return float64(queue.QueueDepth()) }),
+	}
+
+	for _, collector := range clickCollectors {
+		if err := prometheus.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletionQueue — очередь фонового удаления ссылок
+type DeletionQueue interface {
+	Stats() service.DeletionStats
+}
+
+// RegisterDeletionQueue публикует глубину очереди удаления и счётчики
+// удалённых, не удалённых, повторённых и отклонённых ссылок
+func RegisterDeletionQueue(queue DeletionQueue) error {
+	counter := func(name, help string, value func(service.DeletionStats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(queue.Stats())) })
+	}
+
+	deletionCollectors := []prometheus.Collector{
+		counter("deletions_deleted_total", "URLs deleted by the deletion queue.",
+			func(s service.DeletionStats) int64 { return s.Deleted }),
+		counter("deletions_failed_total", "URLs the deletion queue gave up on.",
+			func(s service.DeletionStats) int64 { return s.Failed }),
+		counter("deletions_retried_total", "Deletion batches retried after a transient error.",
+			func(s service.DeletionStats) int64 { return s.Retried }),
+		counter("deletions_rejected_total", "Deletion requests rejected because the queue was full.",
+			func(s service.DeletionStats) int64 { return s.Rejected }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "deletions_queue_depth",
+			Help:      "Deletion requests waiting in the queue.",
+		}, func() float64 { return float64(queue.Stats().QueueDepth) }),
+	}
+
+	for _, collector := range deletionCollectors {
+		if err := prometheus.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
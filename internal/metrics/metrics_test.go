@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/linarium/shortener/internal/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type stubClickQueue struct{}
+
+func (stubClickQueue) Dropped() int64  { return 3 }
+func (stubClickQueue) Failed() int64   { return 2 }
+func (stubClickQueue) QueueDepth() int { return 7 }
+
+func TestRegisterClickQueue(t *testing.T) {
+	if err := RegisterClickQueue(stubClickQueue{}); err != nil {
+		t.Fatalf("failed to register click queue: %v", err)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	want := map[string]float64{
+		"shortener_clicks_dropped_total": 3,
+		"shortener_clicks_failed_total":  2,
+		"shortener_clicks_queue_depth":   7,
+	}
+	for _, family := range families {
+		expected, ok := want[family.GetName()]
+		if !ok {
+			continue
+		}
+		metric := family.GetMetric()[0]
+		value := metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+		if value != expected {
+			t.Errorf("expected %s = %v, got %v", family.GetName(), expected, value)
+		}
+		delete(want, family.GetName())
+	}
+	for name := range want {
+		t.Errorf("expected metric %s to be registered", name)
+	}
+}
+
+type stubDeletionQueue struct{}
+
+func (stubDeletionQueue) Stats() service.DeletionStats {
+	return service.DeletionStats{QueueDepth: 4, Deleted: 10, Failed: 2, Retried: 1, Rejected: 5}
+}
+
+func TestRegisterDeletionQueue(t *testing.T) {
+	if err := RegisterDeletionQueue(stubDeletionQueue{}); err != nil {
+		t.Fatalf("failed to register deletion queue: %v", err)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	want := map[string]float64{
+		"shortener_deletions_deleted_total":  10,
+		"shortener_deletions_failed_total":   2,
+		"shortener_deletions_retried_total":  1,
+		"shortener_deletions_rejected_total": 5,
+		"shortener_deletions_queue_depth":    4,
+	}
+	for _, family := range families {
+		expected, ok := want[family.GetName()]
+		if !ok {
+			continue
+		}
+		metric := family.GetMetric()[0]
+		value := metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+		if value != expected {
+			t.Errorf("expected %s = %v, got %v", family.GetName(), expected, value)
+		}
+		delete(want, family.GetName())
+	}
+	for name := range want {
+		t.Errorf("metric %s is not registered", name)
+	}
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/linarium/shortener/internal/models"
+	"github.com/linarium/shortener/internal/service"
+)
+
+// instrumentedStorage замеряет время операций вложенного хранилища
+type instrumentedStorage struct {
+	storage service.Storage
+}
+
+// InstrumentStorage оборачивает storage замерами StorageDuration
+func InstrumentStorage(storage service.Storage) service.Storage {
+	return &instrumentedStorage{storage: storage}
+}
+
+// track начинает замер операции; возвращённая функция завершает его.
+// Ожидаемые исходы вроде отсутствующей ссылки ошибками не считаются.
+func track(operation string) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		result := "ok"
+		switch {
+		case err == nil:
+		case errors.Is(err, service.ErrNotFound), errors.Is(err, service.ErrGone):
+			result = "miss"
+		case errors.Is(err, service.ErrConflict):
+			result = "conflict"
+		default:
+			result = "error"
+		}
+		StorageDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (s *instrumentedStorage) SaveShortURL(ctx context.Context, model models.URL) error {
+	done := track("save")
+	err := s.storage.SaveShortURL(ctx, model)
+	done(err)
+	return err
+}
+
+func (s *instrumentedStorage) SaveManyURLS(ctx context.Context, urls []models.URL) error {
+	done := track("save_many")
+	err := s.storage.SaveManyURLS(ctx, urls)
+	done(err)
+	return err
+}
+
+func (s *instrumentedStorage) GetAll(ctx context.Context, userID string) ([]models.URL, error) {
+	done := track("get_all")
+	urls, err := s.storage.GetAll(ctx, userID)
+	done(err)
+	return urls, err
+}
+
+func (s *instrumentedStorage) GetLongURL(ctx context.Context, short string) (string, error) {
+	done := track("get_long_url")
+	long, err := s.storage.GetLongURL(ctx, short)
+	done(err)
+	return long, err
+}
+
+func (s *instrumentedStorage) GetURLInfo(ctx context.Context, short string) (*models.URL, error) {
+	done := track("get_url_info")
+	model, err := s.storage.GetURLInfo(ctx, short)
+	done(err)
+	return model, err
+}
+
+func (s *instrumentedStorage) FindShortURLByOriginal(ctx context.Context, original string) (string, error) {
+	done := track("find_by_original")
+	short, err := s.storage.FindShortURLByOriginal(ctx, original)
+	done(err)
+	return short, err
+}
+
+func (s *instrumentedStorage) Ping(ctx context.Context) error {
+	done := track("ping")
+	err := s.storage.Ping(ctx)
+	done(err)
+	return err
+}
+
+func (s *instrumentedStorage) Close() error {
+	return s.storage.Close()
+}
+
+func (s *instrumentedStorage) DeleteURLs(ctx context.Context, userID string, shortURLs []string) error {
+	done := track("delete")
+	err := s.storage.DeleteURLs(ctx, userID, shortURLs)
+	done(err)
+	return err
+}
+
+func (s *instrumentedStorage) DeleteURLsBatch(ctx context.Context, deletions []models.Deletion) error {
+	done := track("delete_batch")
+	err := s.storage.DeleteURLsBatch(ctx, deletions)
+	done(err)
+	return err
+}
+
+func (s *instrumentedStorage) MarkExpired(ctx context.Context, now time.Time) (int, error) {
+	done := track("mark_expired")
+	marked, err := s.storage.MarkExpired(ctx, now)
+	done(err)
+	return marked, err
+}
+
+func (s *instrumentedStorage) Stats(ctx context.Context) (models.Stats, error) {
+	done := track("stats")
+	stats, err := s.storage.Stats(ctx)
+	done(err)
+	return stats, err
+}
+
+// Compact передаёт уплотнение хранилищу, если оно его поддерживает
+func (s *instrumentedStorage) Compact(ctx context.Context) error {
+	compactor, ok := s.storage.(service.Compactor)
+	if !ok {
+		return service.ErrCompactionNotSupported
+	}
+	done := track("compact")
+	err := compactor.Compact(ctx)
+	done(err)
+	return err
+}
@@ -1,18 +1,30 @@
 package models
 
+import "time"
+
 type URL struct {
-	ID          string `db:"id"`
-	UserID      string `db:"user_id"`
-	ShortURL    string `db:"short_url"`
-	OriginalURL string `db:"original_url"`
-	IsDeleted   bool   `json:"is_deleted" db:"is_deleted"`
+	ID          string     `db:"id"`
+	UserID      string     `db:"user_id"`
+	ShortURL    string     `db:"short_url"`
+	OriginalURL string     `db:"original_url"`
+	IsDeleted   bool       `json:"is_deleted" db:"is_deleted"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+// IsExpired сообщает, истёк ли срок действия ссылки к моменту now
+func (u URL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
 }
 
 type BatchRequest []BatchRequestItem
 
 type BatchRequestItem struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	Alias         string     `json:"alias,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	// TTL — срок жизни ссылки в секундах, альтернатива ExpiresAt
+	TTL int64 `json:"ttl,omitempty"`
 }
 
 type BatchResponse []BatchResponseItem
@@ -21,3 +33,44 @@ type BatchResponseItem struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
 }
+
+// Deletion — запрос пользователя на удаление его коротких ссылок
+type Deletion struct {
+	UserID    string
+	ShortURLs []string
+	// RequestID — идентификатор запроса, поставившего удаление в очередь
+	RequestID string
+}
+
+// Click — переход по короткой ссылке
+type Click struct {
+	ShortURL  string    `json:"short_url" db:"short_url"`
+	Timestamp time.Time `json:"timestamp" db:"clicked_at"`
+	Referrer  string    `json:"referrer,omitempty" db:"referrer"`
+	UserAgent string    `json:"user_agent,omitempty" db:"user_agent"`
+	IPHash    string    `json:"ip_hash,omitempty" db:"ip_hash"`
+}
+
+// ClickStats — сводка переходов по короткой ссылке
+type ClickStats struct {
+	ShortURL string  `json:"short_url"`
+	Total    int64   `json:"total"`
+	Recent   []Click `json:"recent"`
+}
+
+// APIKey — ключ доступа пользователя. Сам ключ не хранится, только его хеш;
+// Prefix — начало ключа, по которому пользователь узнаёт его в списке.
+type APIKey struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Name      string    `json:"name" db:"name"`
+	Prefix    string    `json:"prefix" db:"prefix"`
+	Hash      string    `json:"hash" db:"key_hash"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Stats — сводка по сервису для внутреннего мониторинга
+type Stats struct {
+	URLs  int `json:"urls"`
+	Users int `json:"users"`
+}
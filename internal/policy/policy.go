@@ -0,0 +1,226 @@
+// Package policy решает, на какие адреса можно создавать короткие ссылки и
+// переходить по ним. Правила загружаются из JSON-файла и перечитываются при
+// его изменении или по SIGHUP.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/idna"
+)
+
+// Действия правил и политики по умолчанию
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// ErrDenied возвращается для адреса, запрещённого политикой
+var ErrDenied = errors.New("destination is denied by policy")
+
+// Rule — одно правило. Задаётся ровно одно из условий: Domain совпадает с
+// хостом целиком, Suffix — с хостом или его родительским доменом, Regex
+// проверяется по всему URL, CIDR — по хосту, заданному IP-адресом.
+type Rule struct {
+	Action string `json:"action"`
+	Domain string `json:"domain,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+	CIDR   string `json:"cidr,omitempty"`
+}
+
+// File — содержимое файла правил. Правила проверяются по порядку, решает
+// первое совпавшее; если не совпало ни одно, применяется Default.
+type File struct {
+	Default string `json:"default"`
+	Rules   []Rule `json:"rules"`
+}
+
+type compiledRule struct {
+	Rule
+	regex   *regexp.Regexp
+	network *net.IPNet
+}
+
+type ruleSet struct {
+	allowByDefault bool
+	rules          []compiledRule
+}
+
+// Engine проверяет адреса по текущему набору правил. Набор заменяется
+// целиком, поэтому Check не блокируется на время перезагрузки.
+type Engine struct {
+	path  string
+	rules atomic.Pointer[ruleSet]
+}
+
+// Load читает правила из path
+func Load(path string) (*Engine, error) {
+	e := &Engine{path: path}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload перечитывает файл правил. При ошибке остаются прежние правила.
+func (e *Engine) Reload() error {
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse policy file %s: %w", e.path, err)
+	}
+
+	rules, err := compile(file)
+	if err != nil {
+		return fmt.Errorf("policy file %s: %w", e.path, err)
+	}
+
+	e.rules.Store(rules)
+	return nil
+}
+
+// Len возвращает число действующих правил
+func (e *Engine) Len() int {
+	return len(e.rules.Load().rules)
+}
+
+// Check возвращает ErrDenied с причиной, если rawURL запрещён
+func (e *Engine) Check(rawURL string) error {
+	rules := e.rules.Load()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: malformed URL", ErrDenied)
+	}
+	host := strings.ToLower(u.Hostname())
+	if ascii, err := asciiHost(host); err == nil {
+		host = ascii
+	}
+
+	for _, rule := range rules.rules {
+		if !rule.matches(rawURL, host) {
+			continue
+		}
+		if rule.Action == ActionAllow {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrDenied, rule.describe())
+	}
+
+	if rules.allowByDefault {
+		return nil
+	}
+	return fmt.Errorf("%w: host %s is not allowed", ErrDenied, host)
+}
+
+// asciiHost переводит имя хоста в нижний регистр и punycode
+func asciiHost(host string) (string, error) {
+	if host == "" {
+		return "", nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+func compile(file File) (*ruleSet, error) {
+	set := &ruleSet{rules: make([]compiledRule, 0, len(file.Rules))}
+	switch file.Default {
+	case "", ActionAllow:
+		set.allowByDefault = true
+	case ActionDeny:
+	default:
+		return nil, fmt.Errorf("default must be %q or %q", ActionAllow, ActionDeny)
+	}
+
+	for i, rule := range file.Rules {
+		if rule.Action != ActionAllow && rule.Action != ActionDeny {
+			return nil, fmt.Errorf("rule %d: action must be %q or %q", i+1, ActionAllow, ActionDeny)
+		}
+
+		// Адреса сверяются после перевода в punycode, поэтому и правила
+		// с Unicode-именами переводятся в него же
+		compiled := compiledRule{Rule: rule}
+		domain, err := asciiHost(rule.Domain)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: bad domain: %w", i+1, err)
+		}
+		suffix, err := asciiHost(strings.TrimPrefix(rule.Suffix, "."))
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: bad suffix: %w", i+1, err)
+		}
+		compiled.Domain, compiled.Suffix = domain, suffix
+
+		conditions := 0
+		if compiled.Domain != "" {
+			conditions++
+		}
+		if compiled.Suffix != "" {
+			conditions++
+		}
+		if rule.Regex != "" {
+			conditions++
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: bad regex: %w", i+1, err)
+			}
+			compiled.regex = re
+		}
+		if rule.CIDR != "" {
+			conditions++
+			_, network, err := net.ParseCIDR(rule.CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: bad cidr: %w", i+1, err)
+			}
+			compiled.network = network
+		}
+		if conditions != 1 {
+			return nil, fmt.Errorf("rule %d: exactly one of domain, suffix, regex or cidr must be set", i+1)
+		}
+
+		set.rules = append(set.rules, compiled)
+	}
+
+	return set, nil
+}
+
+// matches не разрешает имена в DNS: правило CIDR применяется только к хостам,
+// заданным IP-адресом, иначе проверка зависела бы от чужого DNS
+func (r compiledRule) matches(rawURL, host string) bool {
+	switch {
+	case r.Domain != "":
+		return host == r.Domain
+	case r.Suffix != "":
+		return host == r.Suffix || strings.HasSuffix(host, "."+r.Suffix)
+	case r.regex != nil:
+		return r.regex.MatchString(rawURL)
+	case r.network != nil:
+		ip := net.ParseIP(host)
+		return ip != nil && r.network.Contains(ip)
+	}
+	return false
+}
+
+func (r compiledRule) describe() string {
+	switch {
+	case r.Domain != "":
+		return "domain " + r.Domain
+	case r.Suffix != "":
+		return "domain suffix " + r.Suffix
+	case r.regex != nil:
+		return "pattern " + r.Regex
+	default:
+		return "network " + r.CIDR
+	}
+}
@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRules(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+}
+
+func TestEngineCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writeRules(t, path, `{
+		"default": "deny",
+		"rules": [
+			{"action": "deny", "domain": "phish.corp.example"},
+			{"action": "allow", "suffix": ".corp.example"},
+			{"action": "allow", "regex": "^https://docs\\.example\\.org/"},
+			{"action": "deny", "cidr": "10.0.0.0/8"},
+			{"action": "allow", "cidr": "192.0.2.0/24"}
+		]
+	}`)
+
+	engine, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{url: "https://corp.example/", allowed: true},
+		{url: "https://wiki.corp.example/page", allowed: true},
+		{url: "https://phish.corp.example/login", allowed: false},
+		{url: "https://evilcorp.example/", allowed: false},
+		{url: "https://docs.example.org/guide", allowed: true},
+		{url: "http://docs.example.org/guide", allowed: false},
+		{url: "http://10.1.2.3/", allowed: false},
+		{url: "http://192.0.2.10/", allowed: true},
+		{url: "https://example.com/", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := engine.Check(tt.url)
+			if tt.allowed && err != nil {
+				t.Errorf("expected %s to be allowed, got %v", tt.url, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrDenied) {
+				t.Errorf("expected %s to be denied, got %v", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestEngineCheckIDN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writeRules(t, path, `{
+		"rules": [
+			{"action": "deny", "domain": "Пример.рф"},
+			{"action": "deny", "suffix": ".испытание"}
+		]
+	}`)
+
+	engine, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+
+	for _, denied := range []string{
+		"http://xn--e1afmkfd.xn--p1ai/",
+		"http://пример.рф/",
+		"https://shop.xn--80akhbyknj4f/",
+	} {
+		if err := engine.Check(denied); !errors.Is(err, ErrDenied) {
+			t.Errorf("expected %s to be denied, got %v", denied, err)
+		}
+	}
+	if err := engine.Check("http://xn--e1afmkfd.com/"); err != nil {
+		t.Errorf("expected other hosts to be allowed, got %v", err)
+	}
+
+	writeRules(t, path, `{"rules": [{"action": "deny", "domain": "bad name.example"}]}`)
+	if _, err := Load(path); err == nil {
+		t.Error("expected invalid rule host to be rejected")
+	}
+}
+
+func TestEngineReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	writeRules(t, path, `{"rules": []}`)
+
+	engine, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load policy: %v", err)
+	}
+	if err := engine.Check("https://phish.example/"); err != nil {
+		t.Fatalf("empty policy should allow everything, got %v", err)
+	}
+
+	writeRules(t, path, `{"rules": [{"action": "deny", "suffix": "phish.example"}]}`)
+	if err := engine.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if err := engine.Check("https://phish.example/"); !errors.Is(err, ErrDenied) {
+		t.Fatalf("expected reloaded rule to deny, got %v", err)
+	}
+
+	writeRules(t, path, `{"rules": [{"action": "deny", "domain": "a", "suffix": "b"}]}`)
+	if err := engine.Reload(); err == nil {
+		t.Fatal("expected error for rule with two conditions")
+	}
+	if err := engine.Check("https://phish.example/"); !errors.Is(err, ErrDenied) {
+		t.Errorf("failed reload must keep previous rules, got %v", err)
+	}
+}
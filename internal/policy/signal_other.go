@@ -0,0 +1,8 @@
+//go:build !unix
+
+package policy
+
+import "os"
+
+// reloadSignals пуст: без SIGHUP правила перечитываются только при изменении файла
+var reloadSignals []os.Signal
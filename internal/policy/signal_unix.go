@@ -0,0 +1,11 @@
+//go:build unix
+
+package policy
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals — сигналы, по которым перечитываются правила
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+)
+
+// watchInterval — как часто проверяется время изменения файла правил
+const watchInterval = 5 * time.Second
+
+// Watch перечитывает правила при изменении файла или по сигналу перезагрузки,
+// пока не будет отменён ctx. Ошибки перезагрузки пишутся в лог, а
+// проверки продолжают работать по прежним правилам.
+func (e *Engine) Watch(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(signals, reloadSignals...)
+		defer signal.Stop(signals)
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := e.fileVersion()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			last = e.fileVersion()
+			e.reload("signal")
+		case <-ticker.C:
+			if version := e.fileVersion(); version != last {
+				last = version
+				e.reload("file change")
+			}
+		}
+	}
+}
+
+func (e *Engine) reload(reason string) {
+	if err := e.Reload(); err != nil {
+		logger.Sugar.Errorf("Failed to reload policy on %s, keeping previous rules: %v", reason, err)
+		return
+	}
+	logger.Sugar.Infof("Reloaded policy on %s: %d rules", reason, e.Len())
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func (e *Engine) fileVersion() fileVersion {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return fileVersion{}
+	}
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}
+}
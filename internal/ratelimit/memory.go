@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval — как часто MemoryStore удаляет восстановившиеся корзины
+const sweepInterval = time.Minute
+
+type memoryBucket struct {
+	Bucket
+	// full — момент, когда корзина восстановится и её можно забыть
+	full time.Time
+}
+
+// MemoryStore хранит корзины в памяти процесса
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*memoryBucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{}
+		s.buckets[key] = bucket
+	}
+	result := bucket.Take(limit, now)
+	bucket.full = now.Add(result.Reset)
+
+	return result, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sweep удаляет полные корзины: они неотличимы от отсутствующих
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, bucket := range s.buckets {
+		if !now.Before(bucket.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package ratelimit ограничивает частоту запросов алгоритмом token bucket.
+// Корзина вмещает Limit.Requests токенов и полностью восстанавливается за
+// Limit.Period; каждый запрос расходует один токен.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Классы маршрутов, для которых лимиты настраиваются отдельно
+const (
+	ClassCreate   = "create"
+	ClassBatch    = "batch"
+	ClassRedirect = "redirect"
+	ClassDelete   = "delete"
+)
+
+// ErrInvalidLimit возвращается для лимита в неверном формате
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit — ёмкость корзины и время её полного восстановления.
+// Нулевой лимит отключает ограничение.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled сообщает, ограничивает ли лимит что-нибудь
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// perToken — время восстановления одного токена
+func (l Limit) perToken() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// ParseLimit разбирает лимит вида "60/m", "10/s" или "100/15m".
+// Пустая строка, "0" и "off" отключают ограничение.
+func ParseLimit(spec string) (Limit, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "0" || spec == "off" {
+		return Limit{}, nil
+	}
+
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w %q: expected <requests>/<period>", ErrInvalidLimit, spec)
+	}
+	requests, err := strconv.Atoi(count)
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("%w %q: bad request count", ErrInvalidLimit, spec)
+	}
+
+	var d time.Duration
+	switch period {
+	case "s":
+		d = time.Second
+	case "m":
+		d = time.Minute
+	case "h":
+		d = time.Hour
+	default:
+		d, err = time.ParseDuration(period)
+		if err != nil || d <= 0 {
+			return Limit{}, fmt.Errorf("%w %q: bad period", ErrInvalidLimit, spec)
+		}
+	}
+
+	return Limit{Requests: requests, Period: d}, nil
+}
+
+// Result — исход попытки взять токен
+type Result struct {
+	Allowed bool
+	// Limit — ёмкость корзины
+	Limit int
+	// Remaining — сколько запросов ещё можно сделать сразу
+	Remaining int
+	// RetryAfter — через сколько появится следующий токен, если запрос отклонён
+	RetryAfter time.Duration
+	// Reset — через сколько корзина восстановится полностью
+	Reset time.Duration
+}
+
+// NewResult описывает корзину с limit, в которой после попытки осталось tokens
+func NewResult(limit Limit, tokens float64, allowed bool) Result {
+	perToken := float64(limit.perToken())
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(limit.Requests) - tokens) * perToken),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+	return result
+}
+
+// Store хранит корзины. Take атомарно пополняет корзину key до текущего
+// момента и забирает из неё токен, если он есть.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	Close() error
+}
+
+// TakeAll берёт токен из каждой корзины keys и возвращает самый строгий
+// результат. После первого отказа остальные корзины не трогаются.
+func TakeAll(ctx context.Context, store Store, limit Limit, keys ...string) (Result, error) {
+	var tightest *Result
+	for _, key := range keys {
+		result, err := store.Take(ctx, key, limit)
+		if err != nil {
+			return Result{}, err
+		}
+		if tightest == nil || !result.Allowed || result.Remaining < tightest.Remaining {
+			tightest = &result
+		}
+		if !result.Allowed {
+			break
+		}
+	}
+	if tightest == nil {
+		return Result{Allowed: true, Limit: limit.Requests, Remaining: limit.Requests}, nil
+	}
+	return *tightest, nil
+}
+
+// Bucket — состояние одной корзины
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take пополняет корзину к моменту now и забирает токен, если он есть.
+// Пустая корзина считается полной.
+func (b *Bucket) Take(limit Limit, now time.Time) Result {
+	if b.Updated.IsZero() {
+		b.Tokens = float64(limit.Requests)
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens = math.Min(float64(limit.Requests), b.Tokens+float64(elapsed)/float64(limit.perToken()))
+	}
+	if now.After(b.Updated) {
+		b.Updated = now
+	}
+
+	allowed := b.Tokens >= 1
+	if allowed {
+		b.Tokens--
+	}
+	return NewResult(limit, b.Tokens, allowed)
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Limit
+		wantErr bool
+	}{
+		{spec: "60/m", want: Limit{Requests: 60, Period: time.Minute}},
+		{spec: "5/s", want: Limit{Requests: 5, Period: time.Second}},
+		{spec: "100/15m", want: Limit{Requests: 100, Period: 15 * time.Minute}},
+		{spec: "off"},
+		{spec: ""},
+		{spec: "60", wantErr: true},
+		{spec: "x/m", wantErr: true},
+		{spec: "10/-1s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseLimit(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: 2 * time.Second}
+
+	for i := 0; i < 2; i++ {
+		if result, _ := store.Take(context.Background(), "k", limit); !result.Allowed {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+	}
+
+	result, _ := store.Take(context.Background(), "k", limit)
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("expected empty bucket, got %+v", result)
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("expected retry after 1s, got %v", result.RetryAfter)
+	}
+
+	if other, _ := store.Take(context.Background(), "other", limit); !other.Allowed {
+		t.Error("buckets with different keys must be independent")
+	}
+
+	now = now.Add(time.Second)
+	if result, _ := store.Take(context.Background(), "k", limit); !result.Allowed {
+		t.Error("bucket should refill one token per second")
+	}
+}
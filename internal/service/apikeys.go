@@ -0,0 +1,296 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/linarium/shortener/internal/config"
+	"github.com/linarium/shortener/internal/models"
+)
+
+// apiKeysFileSuffix — суффикс файла ключей доступа рядом с файлом хранилища
+const apiKeysFileSuffix = ".apikeys"
+
+// APIKeyStore хранит хеши ключей доступа пользователей
+type APIKeyStore interface {
+	SaveAPIKey(ctx context.Context, key models.APIKey) error
+	// ListAPIKeys возвращает ключи пользователя, начиная с самого старого
+	ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
+	// RevokeAPIKey удаляет ключ id, если он принадлежит userID
+	RevokeAPIKey(ctx context.Context, userID, id string) (bool, error)
+	FindAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, bool, error)
+	Close() error
+}
+
+// NewAPIKeyStore выбирает хранилище ключей под тот же бэкенд, что и storage
+func NewAPIKeyStore(ctx context.Context, cfg config.Config, storage Storage) (APIKeyStore, error) {
+	if dbStorage, ok := storage.(*DBStorage); ok {
+		return &DBAPIKeyStore{db: dbStorage.db}, nil
+	}
+
+	if _, ok := storage.(*FileStorage); ok {
+		return NewFileAPIKeyStore(cfg.FileStoragePath+apiKeysFileSuffix, cfg.FileStorageStrict)
+	}
+
+	return NewMemoryAPIKeyStore(), nil
+}
+
+type MemoryAPIKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]models.APIKey
+	byHash map[string]string
+}
+
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{
+		keys:   make(map[string]models.APIKey),
+		byHash: make(map[string]string),
+	}
+}
+
+func (s *MemoryAPIKeyStore) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = key
+	s.byHash[key.Hash] = key.ID
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []models.APIKey
+	for _, key := range s.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) RevokeAPIKey(ctx context.Context, userID, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revoke(userID, id), nil
+}
+
+func (s *MemoryAPIKeyStore) owns(userID, id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, exists := s.keys[id]
+	return exists && key.UserID == userID
+}
+
+// revoke вызывается под s.mu
+func (s *MemoryAPIKeyStore) revoke(userID, id string) bool {
+	key, exists := s.keys[id]
+	if !exists || key.UserID != userID {
+		return false
+	}
+	delete(s.keys, id)
+	delete(s.byHash, key.Hash)
+	return true
+}
+
+func (s *MemoryAPIKeyStore) FindAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.byHash[hash]
+	if !exists {
+		return models.APIKey{}, false, nil
+	}
+	return s.keys[id], true, nil
+}
+
+func (s *MemoryAPIKeyStore) Close() error {
+	return nil
+}
+
+// apiKeyRecord — строка файла ключей: создание ключа или его отзыв
+type apiKeyRecord struct {
+	Op string `json:"op"`
+	models.APIKey
+}
+
+// FileAPIKeyStore дописывает создание и отзыв ключей в JSONL-файл
+// и держит действующие ключи в памяти
+type FileAPIKeyStore struct {
+	memory *MemoryAPIKeyStore
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// NewFileAPIKeyStore загружает ключи из filePath. Повреждённые записи
+// обрабатываются так же, как в журнале FileStorage, strict запрещает запуск с ними.
+func NewFileAPIKeyStore(filePath string, strict bool) (*FileAPIKeyStore, error) {
+	memory := NewMemoryAPIKeyStore()
+	_, err := recoverLines(filePath, strict, func(line []byte) error {
+		var record apiKeyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		switch record.Op {
+		case opCreate:
+			memory.SaveAPIKey(context.Background(), record.APIKey)
+		case opDelete:
+			memory.revoke(record.UserID, record.ID)
+		default:
+			return fmt.Errorf("unknown API key operation %q", record.Op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAPIKeyStore{
+		memory: memory,
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+func (s *FileAPIKeyStore) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(apiKeyRecord{Op: opCreate, APIKey: key}); err != nil {
+		return err
+	}
+	return s.memory.SaveAPIKey(ctx, key)
+}
+
+func (s *FileAPIKeyStore) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	return s.memory.ListAPIKeys(ctx, userID)
+}
+
+func (s *FileAPIKeyStore) RevokeAPIKey(ctx context.Context, userID, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.memory.owns(userID, id) {
+		return false, nil
+	}
+	if err := s.append(apiKeyRecord{Op: opDelete, APIKey: models.APIKey{ID: id, UserID: userID}}); err != nil {
+		return false, err
+	}
+	return s.memory.RevokeAPIKey(ctx, userID, id)
+}
+
+func (s *FileAPIKeyStore) FindAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, bool, error) {
+	return s.memory.FindAPIKeyByHash(ctx, hash)
+}
+
+// append вызывается под s.mu
+func (s *FileAPIKeyStore) append(record apiKeyRecord) error {
+	if err := json.NewEncoder(s.writer).Encode(record); err != nil {
+		return err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileAPIKeyStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writer.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// DBAPIKeyStore хранит ключи в таблице api_keys и использует пул DBStorage
+type DBAPIKeyStore struct {
+	db DB
+}
+
+func (s *DBAPIKeyStore) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	_, err := s.db.NamedExecContext(ctx, `
+        INSERT INTO api_keys (id, user_id, name, prefix, key_hash, created_at)
+        VALUES (:id, :user_id, :name, :prefix, :key_hash, :created_at)
+    `, key)
+	if err != nil {
+		return dbError("save API key", err)
+	}
+	return nil
+}
+
+func (s *DBAPIKeyStore) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := s.db.SelectContext(ctx, &keys, `
+        SELECT id, user_id, name, prefix, key_hash, created_at
+        FROM api_keys
+        WHERE user_id = $1
+        ORDER BY created_at
+    `, userID)
+	if err != nil {
+		return nil, dbError("list API keys", err)
+	}
+	return keys, nil
+}
+
+func (s *DBAPIKeyStore) RevokeAPIKey(ctx context.Context, userID, id string) (bool, error) {
+	// Столбец id имеет тип uuid: иначе Postgres отклонит запрос с ошибкой 22P02
+	if _, err := uuid.Parse(id); err != nil {
+		return false, nil
+	}
+	result, err := s.db.ExecContext(ctx, `
+        DELETE FROM api_keys WHERE id = $1 AND user_id = $2
+    `, id, userID)
+	if err != nil {
+		return false, dbError("revoke API key", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, dbError("revoke API key", err)
+	}
+	return affected > 0, nil
+}
+
+func (s *DBAPIKeyStore) FindAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, bool, error) {
+	var key models.APIKey
+	err := s.db.QueryRowxContext(ctx, `
+        SELECT id, user_id, name, prefix, key_hash, created_at
+        FROM api_keys
+        WHERE key_hash = $1
+    `, hash).StructScan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, false, nil
+	}
+	if err != nil {
+		return models.APIKey{}, false, dbError("find API key", err)
+	}
+	return key, true, nil
+}
+
+// Close ничего не делает: пулом соединений владеет DBStorage
+func (s *DBAPIKeyStore) Close() error {
+	return nil
+}
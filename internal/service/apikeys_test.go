@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+)
+
+func TestFileAPIKeyStoreReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json"+apiKeysFileSuffix)
+
+	store, err := NewFileAPIKeyStore(path, false)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	kept := models.APIKey{ID: "k1", UserID: "u1", Prefix: "shk_AAAA", Hash: "h1", CreatedAt: time.Now()}
+	revoked := models.APIKey{ID: "k2", UserID: "u1", Prefix: "shk_BBBB", Hash: "h2", CreatedAt: time.Now()}
+	for _, key := range []models.APIKey{kept, revoked} {
+		if err := store.SaveAPIKey(ctx, key); err != nil {
+			t.Fatalf("failed to save key: %v", err)
+		}
+	}
+
+	if ok, _ := store.RevokeAPIKey(ctx, "u2", "k2"); ok {
+		t.Error("expected revoke by another user to fail")
+	}
+	if ok, _ := store.RevokeAPIKey(ctx, "u1", "k2"); !ok {
+		t.Error("expected owner to revoke the key")
+	}
+	store.Close()
+
+	reopened, err := NewFileAPIKeyStore(path, false)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+
+	if key, found, _ := reopened.FindAPIKeyByHash(ctx, "h1"); !found || key.UserID != "u1" {
+		t.Errorf("expected kept key after replay, got %+v (found=%v)", key, found)
+	}
+	if _, found, _ := reopened.FindAPIKeyByHash(ctx, "h2"); found {
+		t.Error("expected revoked key to stay revoked after replay")
+	}
+}
+
+func TestFileAPIKeyStoreRecovery(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json"+apiKeysFileSuffix)
+
+	content := `{"op":"create","id":"k1","user_id":"u1","hash":"h1"}` + "\n" +
+		`not json` + "\n" +
+		`{"op":"create","id":"k2","user_id":"u1","hash":"h2"}` + "\n" +
+		`{"op":"create","id":"k3","Us`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write keys: %v", err)
+	}
+
+	if _, err := NewFileAPIKeyStore(path, true); err == nil {
+		t.Fatal("expected strict mode to fail on corrupt record")
+	}
+
+	store, err := NewFileAPIKeyStore(path, false)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	for _, hash := range []string{"h1", "h2"} {
+		if _, found, _ := store.FindAPIKeyByHash(ctx, hash); !found {
+			t.Errorf("expected key %s to survive recovery", hash)
+		}
+	}
+	quarantined, _ := os.ReadFile(path + quarantineSuffix)
+	if string(quarantined) != "not json\n" {
+		t.Errorf("expected malformed line in quarantine, got %q", quarantined)
+	}
+	if err := store.SaveAPIKey(ctx, models.APIKey{ID: "k4", UserID: "u1", Hash: "h4"}); err != nil {
+		t.Fatalf("failed to save key: %v", err)
+	}
+	store.Close()
+
+	// Восстановленный файл читается и в строгом режиме
+	reopened, err := NewFileAPIKeyStore(path, true)
+	if err != nil {
+		t.Fatalf("failed to reopen recovered store: %v", err)
+	}
+	defer reopened.Close()
+	if keys, _ := reopened.ListAPIKeys(ctx, "u1"); len(keys) != 3 {
+		t.Errorf("expected 3 keys after reopen, got %d", len(keys))
+	}
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/linarium/shortener/internal/config"
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+)
+
+// clicksFileSuffix — суффикс файла переходов рядом с файлом хранилища
+const clicksFileSuffix = ".clicks"
+
+// maxRecentClicks — сколько последних переходов по ссылке держат в памяти
+// MemoryClickStore и FileClickStore
+const maxRecentClicks = 100
+
+// ClickStore хранит переходы по коротким ссылкам
+type ClickStore interface {
+	SaveClicks(ctx context.Context, clicks []models.Click) error
+	// GetClickStats возвращает общее число переходов и не более recent последних,
+	// начиная с самого свежего
+	GetClickStats(ctx context.Context, shortURL string, recent int) (models.ClickStats, error)
+	Close() error
+}
+
+// NewClickStore выбирает хранилище переходов под тот же бэкенд, что и storage
+func NewClickStore(ctx context.Context, cfg config.Config, storage Storage) (ClickStore, error) {
+	if dbStorage, ok := storage.(*DBStorage); ok {
+		return &DBClickStore{db: dbStorage.db}, nil
+	}
+
+	if _, ok := storage.(*FileStorage); ok {
+		opts, err := fileStorageOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewFileClickStore(cfg.FileStoragePath+clicksFileSuffix, opts)
+	}
+
+	return NewMemoryClickStore(), nil
+}
+
+type linkClicks struct {
+	total  int64
+	recent []models.Click
+}
+
+type MemoryClickStore struct {
+	mu     sync.RWMutex
+	clicks map[string]*linkClicks
+}
+
+func NewMemoryClickStore() *MemoryClickStore {
+	return &MemoryClickStore{clicks: make(map[string]*linkClicks)}
+}
+
+func (s *MemoryClickStore) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, click := range clicks {
+		link, exists := s.clicks[click.ShortURL]
+		if !exists {
+			link = &linkClicks{}
+			s.clicks[click.ShortURL] = link
+		}
+		link.total++
+		link.recent = append(link.recent, click)
+		if len(link.recent) > maxRecentClicks {
+			link.recent = link.recent[len(link.recent)-maxRecentClicks:]
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryClickStore) GetClickStats(ctx context.Context, shortURL string, recent int) (models.ClickStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := models.ClickStats{ShortURL: shortURL, Recent: []models.Click{}}
+	link, exists := s.clicks[shortURL]
+	if !exists {
+		return stats, nil
+	}
+
+	stats.Total = link.total
+	for i := len(link.recent) - 1; i >= 0 && len(stats.Recent) < recent; i-- {
+		stats.Recent = append(stats.Recent, link.recent[i])
+	}
+
+	return stats, nil
+}
+
+// restore заменяет сводку по ссылке снимком из файла переходов
+func (s *MemoryClickStore) restore(shortURL string, total int64, recent []models.Click) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clicks[shortURL] = &linkClicks{total: total, recent: recent}
+}
+
+// snapshot возвращает сводки по всем ссылкам в виде строк файла переходов
+func (s *MemoryClickStore) snapshot() []clickRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]clickRecord, 0, len(s.clicks))
+	for shortURL, link := range s.clicks {
+		records = append(records, clickRecord{
+			Op:     opSnapshot,
+			Click:  models.Click{ShortURL: shortURL},
+			Total:  link.total,
+			Recent: link.recent,
+		})
+	}
+	return records
+}
+
+func (s *MemoryClickStore) links() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.clicks)
+}
+
+func (s *MemoryClickStore) Close() error {
+	return nil
+}
+
+// clickRecord — строка файла переходов: переход или, после уплотнения,
+// снимок сводки по ссылке. Строки старого формата без op — переходы.
+type clickRecord struct {
+	Op string `json:"op,omitempty"`
+	models.Click
+	Total  int64          `json:"total,omitempty"`
+	Recent []models.Click `json:"recent,omitempty"`
+}
+
+// opSnapshot — снимок сводки переходов по ссылке
+const opSnapshot = "snapshot"
+
+// FileClickStore дописывает переходы в JSONL-файл и держит сводку в памяти.
+// Файл сбрасывается на диск по политике opts.Sync и уплотняется до снимков
+// сводок, когда устаревших строк набирается opts.CompactRecords.
+type FileClickStore struct {
+	memory *MemoryClickStore
+	path   string
+	opts   FileStorageOptions
+
+	mu       sync.Mutex
+	file     *os.File
+	writer   *bufio.Writer
+	records  int
+	lastSync time.Time
+}
+
+// NewFileClickStore загружает переходы из filePath. Повреждённые строки
+// обрабатываются так же, как в журнале FileStorage; CompactSize не используется.
+func NewFileClickStore(filePath string, opts FileStorageOptions) (*FileClickStore, error) {
+	if opts.Sync == "" {
+		opts.Sync = SyncInterval
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultSyncInterval
+	}
+
+	memory := NewMemoryClickStore()
+	records, err := recoverLines(filePath, opts.Strict, func(line []byte) error {
+		var record clickRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		switch record.Op {
+		case "":
+			memory.SaveClicks(context.Background(), []models.Click{record.Click})
+		case opSnapshot:
+			memory.restore(record.ShortURL, record.Total, record.Recent)
+		default:
+			return fmt.Errorf("unknown click record op %q", record.Op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileClickStore{memory: memory, path: filePath, opts: opts, records: records, lastSync: time.Now()}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open вызывается под s.mu или до начала работы
+func (s *FileClickStore) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (s *FileClickStore) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	encoder := json.NewEncoder(s.writer)
+	for _, click := range clicks {
+		if err := encoder.Encode(clickRecord{Click: click}); err != nil {
+			return err
+		}
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if err := s.sync(false); err != nil {
+		return err
+	}
+	s.records += len(clicks)
+
+	if err := s.memory.SaveClicks(ctx, clicks); err != nil {
+		return err
+	}
+
+	if s.opts.CompactRecords > 0 && s.records-s.memory.links() >= s.opts.CompactRecords {
+		if err := s.compact(); err != nil {
+			// Переходы уже записаны, неудачное уплотнение повторится позже
+			logger.FromContext(ctx).Errorf("Failed to compact %s: %v", s.path, err)
+		}
+	}
+	return nil
+}
+
+// sync сбрасывает файл на диск по политике; force игнорирует период.
+// Вызывается под s.mu.
+func (s *FileClickStore) sync(force bool) error {
+	switch {
+	case s.opts.Sync == SyncNone:
+		return nil
+	case s.opts.Sync == SyncInterval && !force && time.Since(s.lastSync) < s.opts.SyncInterval:
+		return nil
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.lastSync = time.Now()
+	return nil
+}
+
+// compact заменяет файл снимками сводок по ссылкам. Вызывается под s.mu.
+func (s *FileClickStore) compact() error {
+	snapshot := s.memory.snapshot()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, record := range snapshot {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	file, err := replaceLog(tmp.Name(), s.path, os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+
+	s.file.Close()
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.records = len(snapshot)
+	s.lastSync = time.Now()
+	return syncDir(filepath.Dir(s.path))
+}
+
+func (s *FileClickStore) GetClickStats(ctx context.Context, shortURL string, recent int) (models.ClickStats, error) {
+	return s.memory.GetClickStats(ctx, shortURL, recent)
+}
+
+func (s *FileClickStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.writer.Flush()
+	if err == nil {
+		err = s.sync(true)
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// DBClickStore хранит переходы в таблице clicks и использует пул DBStorage
+type DBClickStore struct {
+	db DB
+}
+
+// maxClicksPerInsert держит многострочный INSERT в пределах лимита
+// Postgres на число параметров запроса
+const maxClicksPerInsert = 1000
+
+// SaveClicks пишет переходы многострочными INSERT
+func (s *DBClickStore) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	query := `
+        INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, ip_hash)
+        VALUES (:short_url, :clicked_at, :referrer, :user_agent, :ip_hash)
+    `
+	for len(clicks) > 0 {
+		chunk := clicks[:min(len(clicks), maxClicksPerInsert)]
+		if _, err := s.db.NamedExecContext(ctx, query, chunk); err != nil {
+			return dbError("save clicks", err)
+		}
+		clicks = clicks[len(chunk):]
+	}
+
+	return nil
+}
+
+func (s *DBClickStore) GetClickStats(ctx context.Context, shortURL string, recent int) (models.ClickStats, error) {
+	stats := models.ClickStats{ShortURL: shortURL, Recent: []models.Click{}}
+
+	err := s.db.QueryRowxContext(ctx, `
+        SELECT count(*) FROM clicks WHERE short_url = $1
+    `, shortURL).Scan(&stats.Total)
+	if err != nil {
+		return stats, dbError("count clicks", err)
+	}
+
+	err = s.db.SelectContext(ctx, &stats.Recent, `
+        SELECT short_url, clicked_at, COALESCE(referrer, '') AS referrer,
+               COALESCE(user_agent, '') AS user_agent, COALESCE(ip_hash, '') AS ip_hash
+        FROM clicks
+        WHERE short_url = $1
+        ORDER BY clicked_at DESC
+        LIMIT $2
+    `, shortURL, recent)
+	if err != nil {
+		return stats, dbError("get recent clicks", err)
+	}
+
+	return stats, nil
+}
+
+// Close ничего не делает: пулом соединений владеет DBStorage
+func (s *DBClickStore) Close() error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+)
+
+func TestFileClickStoreRecovery(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json"+clicksFileSuffix)
+
+	content := `{"short_url":"aaa","timestamp":"2024-01-01T00:00:00Z"}` + "\n" +
+		`{"short_url":"aaa","timest`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write clicks: %v", err)
+	}
+
+	if _, err := NewFileClickStore(path, FileStorageOptions{Strict: true}); err == nil {
+		t.Fatal("expected strict mode to fail on torn tail")
+	}
+
+	store, err := NewFileClickStore(path, FileStorageOptions{Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("expected torn tail to be truncated, got %v", err)
+	}
+	if err := store.SaveClicks(ctx, []models.Click{{ShortURL: "aaa", Timestamp: time.Now()}}); err != nil {
+		t.Fatalf("failed to save clicks: %v", err)
+	}
+	store.Close()
+
+	reopened, err := NewFileClickStore(path, FileStorageOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("failed to reopen recovered store: %v", err)
+	}
+	defer reopened.Close()
+	if stats, _ := reopened.GetClickStats(ctx, "aaa", 10); stats.Total != 2 {
+		t.Errorf("expected 2 clicks after recovery, got %d", stats.Total)
+	}
+}
+
+func TestFileClickStoreCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json"+clicksFileSuffix)
+
+	store, err := NewFileClickStore(path, FileStorageOptions{CompactRecords: 10})
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		click := models.Click{ShortURL: "aaa", Timestamp: time.Unix(int64(i), 0).UTC()}
+		if i%5 == 0 {
+			click.ShortURL = "bbb"
+		}
+		if err := store.SaveClicks(ctx, []models.Click{click}); err != nil {
+			t.Fatalf("failed to save click: %v", err)
+		}
+	}
+	store.Close()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read clicks: %v", err)
+	}
+	if lines := bytes.Count(content, []byte("\n")); lines >= 12 {
+		t.Errorf("expected the file to be compacted, got %d lines", lines)
+	}
+
+	reopened, err := NewFileClickStore(path, FileStorageOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+
+	aaa, _ := reopened.GetClickStats(ctx, "aaa", 3)
+	bbb, _ := reopened.GetClickStats(ctx, "bbb", 3)
+	if aaa.Total != 20 || bbb.Total != 5 {
+		t.Errorf("expected totals 20 and 5 after compaction, got %d and %d", aaa.Total, bbb.Total)
+	}
+	if len(aaa.Recent) != 3 || aaa.Recent[0].Timestamp.Unix() != 24 {
+		t.Errorf("expected the latest clicks first, got %+v", aaa.Recent)
+	}
+}
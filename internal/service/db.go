@@ -3,13 +3,17 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"github.com/linarium/shortener/internal/logger"
 	"github.com/linarium/shortener/internal/models"
 	"github.com/pressly/goose/v3"
 )
@@ -32,6 +36,14 @@ type DBStorage struct {
 	db DB
 }
 
+// SQLDB возвращает пул соединений для мониторинга или nil, если пул не из database/sql
+func (s *DBStorage) SQLDB() *sql.DB {
+	if db, ok := s.db.(*sqlx.DB); ok {
+		return db.DB
+	}
+	return nil
+}
+
 func (s *DBStorage) Ping(ctx context.Context) error {
 	return s.db.PingContext(ctx)
 }
@@ -51,11 +63,11 @@ func NewDBStorage(ctx context.Context, dataSourceName string) (*DBStorage, error
 	}
 
 	if err = db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, dbError("ping database", err)
 	}
 
 	if err := applyMigrations(db); err != nil {
-		return nil, fmt.Errorf("failed to apply migrations: %w", err)
+		return nil, dbError("apply migrations", err)
 	}
 
 	return &DBStorage{db: db}, nil
@@ -72,7 +84,7 @@ func applyMigrations(db DB) error {
 	}
 
 	if err := goose.Up(sqlDB.DB, "migrations"); err != nil {
-		return fmt.Errorf("failed to apply migrations: %w", err)
+		return dbError("apply migrations", err)
 	}
 
 	return nil
@@ -80,48 +92,74 @@ func applyMigrations(db DB) error {
 
 func (s *DBStorage) SaveShortURL(ctx context.Context, model models.URL) error {
 	_, err := s.db.ExecContext(ctx, `
-        INSERT INTO urls (id, user_id, short_url, original_url)
-        VALUES ($1, $2, $3, $4)
-    `, model.ID, model.UserID, model.ShortURL, model.OriginalURL)
+        INSERT INTO urls (id, user_id, short_url, original_url, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `, model.ID, model.UserID, model.ShortURL, model.OriginalURL, model.ExpiresAt)
 	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == pgerrcode.UniqueViolation {
-			return fmt.Errorf("duplicate_original:%s", model.OriginalURL)
+		if isShortURLViolation(err) {
+			return fmt.Errorf("%w: %s", ErrShortURLExists, model.ShortURL)
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			existing, findErr := s.FindShortURLByOriginal(ctx, model.OriginalURL)
+			if findErr != nil {
+				return fmt.Errorf("failed to find duplicate URL: %w", findErr)
+			}
+			return &DuplicateURLError{ShortURL: existing}
 		}
-		return fmt.Errorf("failed to save URL: %w", err)
+		return dbError("save URL", err)
 	}
 
 	return nil
 }
 
-func (s *DBStorage) GetLongURL(ctx context.Context, short string) (string, bool, bool) {
+// shortURLConstraint — имя ограничения уникальности urls.short_url
+const shortURLConstraint = "urls_short_url_key"
+
+// isShortURLViolation отличает конфликт короткой ссылки от дубликата оригинального URL
+func isShortURLViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		pgErr.Code == pgerrcode.UniqueViolation &&
+		pgErr.ConstraintName == shortURLConstraint
+}
+
+func (s *DBStorage) GetLongURL(ctx context.Context, short string) (string, error) {
 	var long string
 	var isDeleted bool
+	var expiresAt sql.NullTime
 
 	err := s.db.QueryRowxContext(ctx, `
-        SELECT original_url, is_deleted
+        SELECT original_url, is_deleted, expires_at
         FROM urls
         WHERE short_url = $1
-    `, short).Scan(&long, &isDeleted)
-
+    `, short).Scan(&long, &isDeleted, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
 	if err != nil {
-		return "", false, false
+		return "", dbError("get URL", err)
 	}
 
-	if isDeleted {
-		return "", true, true
+	// Истёкшая ссылка недоступна и до того, как её пометит фоновая очистка
+	if isDeleted || expiresAt.Valid && !time.Now().Before(expiresAt.Time) {
+		return "", ErrGone
 	}
 
-	return long, true, false
+	return long, nil
 }
 
 func (s *DBStorage) SaveManyURLS(ctx context.Context, models []models.URL) error {
 	query := `
-        INSERT INTO urls (id, user_id, short_url, original_url)
-        VALUES (:id, :user_id, :short_url, :original_url)
+        INSERT INTO urls (id, user_id, short_url, original_url, expires_at)
+        VALUES (:id, :user_id, :short_url, :original_url, :expires_at)
     `
 	_, err := s.db.NamedExecContext(ctx, query, models)
 	if err != nil {
-		return fmt.Errorf("failed to save batch URLs: %w", err)
+		if isShortURLViolation(err) {
+			return fmt.Errorf("failed to save batch URLs: %w", ErrShortURLExists)
+		}
+		return dbError("save batch URLs", err)
 	}
 
 	return nil
@@ -131,14 +169,14 @@ func (s *DBStorage) GetAll(ctx context.Context, userID string) ([]models.URL, er
 	var urls []models.URL
 
 	query := `
-		SELECT short_url, original_url 
-		FROM urls 
+		SELECT short_url, original_url, expires_at
+		FROM urls
 		WHERE user_id = $1 AND deleted_at IS NULL
 	`
 
 	err := s.db.SelectContext(ctx, &urls, query, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user URLs: %w", err)
+		return nil, dbError("get user URLs", err)
 	}
 
 	return urls, nil
@@ -167,29 +205,93 @@ func (s *DBStorage) DeleteURLs(ctx context.Context, userID string, shortURLs []s
 
 	result, err := s.db.ExecContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to delete URLs: %w", err)
+		return dbError("delete URLs", err)
 	}
 
 	rowsAffected, _ := result.RowsAffected()
-	fmt.Printf("Soft deleted %d URLs for user %s\n", rowsAffected, userID)
+	logger.FromContext(ctx).Debugf("Soft deleted %d URLs for user %s", rowsAffected, userID)
 
 	return nil
 }
 
-func (s *DBStorage) GetURLInfo(ctx context.Context, short string) (*models.URL, bool, error) {
+// DeleteURLsBatch помечает удалёнными ссылки нескольких пользователей одним UPDATE.
+// Пользователи с идентификатором не в формате uuid пропускаются: ссылок у них
+// быть не может, а ошибка приведения типа отклонила бы всю пачку.
+func (s *DBStorage) DeleteURLsBatch(ctx context.Context, deletions []models.Deletion) error {
+	var userIDs, shortURLs []string
+	for _, deletion := range deletions {
+		if _, err := uuid.Parse(deletion.UserID); err != nil {
+			logger.FromContext(ctx).Warnf("Skipping deletion for malformed user ID %q", deletion.UserID)
+			continue
+		}
+		for _, shortURL := range deletion.ShortURLs {
+			userIDs = append(userIDs, deletion.UserID)
+			shortURLs = append(shortURLs, shortURL)
+		}
+	}
+	if len(shortURLs) == 0 {
+		return nil
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+        UPDATE urls
+        SET is_deleted = TRUE
+        FROM unnest($1::uuid[], $2::text[]) AS d(user_id, short_url)
+        WHERE urls.user_id = d.user_id
+        AND urls.short_url = d.short_url
+        AND urls.is_deleted = FALSE
+    `, userIDs, shortURLs)
+	if err != nil {
+		return dbError("delete URLs", err)
+	}
+
+	return nil
+}
+
+func (s *DBStorage) Stats(ctx context.Context) (models.Stats, error) {
+	var stats models.Stats
+	err := s.db.QueryRowxContext(ctx, `
+        SELECT count(*), count(DISTINCT user_id) FROM urls WHERE NOT is_deleted
+    `).Scan(&stats.URLs, &stats.Users)
+	if err != nil {
+		return models.Stats{}, dbError("count urls", err)
+	}
+	return stats, nil
+}
+
+// MarkExpired помечает удалёнными ссылки, срок действия которых истёк к now
+func (s *DBStorage) MarkExpired(ctx context.Context, now time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `
+        UPDATE urls
+        SET is_deleted = TRUE
+        WHERE expires_at <= $1 AND is_deleted = FALSE
+    `, now)
+	if err != nil {
+		return 0, dbError("mark expired URLs", err)
+	}
+
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, dbError("mark expired URLs", err)
+	}
+
+	return int(marked), nil
+}
+
+func (s *DBStorage) GetURLInfo(ctx context.Context, short string) (*models.URL, error) {
 	var url models.URL
 	err := s.db.QueryRowxContext(ctx, `
-		SELECT short_url, original_url, is_deleted
+		SELECT id, user_id, short_url, original_url, is_deleted, expires_at
 		FROM urls
 		WHERE short_url = $1
-	`, short).Scan(&url.ShortURL, &url.OriginalURL, &url.IsDeleted)
+	`, short).StructScan(&url)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, false, nil
-		}
-		return nil, false, fmt.Errorf("failed to get URL info: %w", err)
+		return nil, dbError("get URL info", err)
 	}
 
-	return &url, true, nil
+	return &url, nil
 }
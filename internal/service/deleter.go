@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// Значения по умолчанию для DeletionQueueOptions
+const (
+	defaultDeleteWorkers   = 4
+	defaultDeleteQueueSize = 1000
+	defaultDeleteBatchSize = 500
+	defaultDeleteRetries   = 3
+	defaultDeleteBackoff   = 100 * time.Millisecond
+	deleteTimeout          = 10 * time.Second
+)
+
+var (
+	// ErrDeletionQueueFull возвращается, если очередь удаления переполнена
+	ErrDeletionQueueFull = errors.New("deletion queue is full")
+	// ErrDeletionQueueClosed возвращается после остановки очереди удаления
+	ErrDeletionQueueClosed = errors.New("deletion queue is closed")
+)
+
+type DeletionQueueOptions struct {
+	// Workers — число обработчиков, одновременно обращающихся к хранилищу
+	Workers int
+	// QueueSize — ёмкость очереди запросов на удаление
+	QueueSize int
+	// BatchSize — сколько ссылок объединяется в одну операцию хранилища
+	BatchSize int
+	// MaxRetries и RetryBackoff задают повторы при временных ошибках;
+	// пауза удваивается с каждой попыткой, отрицательный MaxRetries
+	// отключает повторы
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// DeletionStats — состояние очереди удаления
+type DeletionStats struct {
+	QueueDepth int   `json:"queue_depth"`
+	Deleted    int64 `json:"deleted"`
+	Failed     int64 `json:"failed"`
+	Retried    int64 `json:"retried"`
+	Rejected   int64 `json:"rejected"`
+}
+
+// DeletionQueue обрабатывает запросы на удаление фиксированным пулом
+// обработчиков. Накопившиеся запросы объединяются в пачки и удаляются
+// одним вызовом DeleteURLsBatch.
+type DeletionQueue struct {
+	storage Storage
+	opts    DeletionQueueOptions
+
+	// mu защищает закрытие очереди от конкурентной записи в неё
+	mu     sync.RWMutex
+	closed bool
+	queue  chan models.Deletion
+	wg     sync.WaitGroup
+
+	deleted  atomic.Int64
+	failed   atomic.Int64
+	retried  atomic.Int64
+	rejected atomic.Int64
+}
+
+func NewDeletionQueue(storage Storage, opts DeletionQueueOptions) *DeletionQueue {
+	if opts.Workers <= 0 {
+		opts.Workers = defaultDeleteWorkers
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultDeleteQueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultDeleteBatchSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultDeleteRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultDeleteBackoff
+	}
+
+	q := &DeletionQueue{
+		storage: storage,
+		opts:    opts,
+		queue:   make(chan models.Deletion, opts.QueueSize),
+	}
+
+	q.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go q.worker()
+	}
+
+	return q
+}
+
+// Enqueue ставит удаление в очередь, не дожидаясь его выполнения
+func (q *DeletionQueue) Enqueue(deletion models.Deletion) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrDeletionQueueClosed
+	}
+
+	select {
+	case q.queue <- deletion:
+		return nil
+	default:
+		q.rejected.Add(1)
+		return ErrDeletionQueueFull
+	}
+}
+
+func (q *DeletionQueue) Stats() DeletionStats {
+	return DeletionStats{
+		QueueDepth: len(q.queue),
+		Deleted:    q.deleted.Load(),
+		Failed:     q.failed.Load(),
+		Retried:    q.retried.Load(),
+		Rejected:   q.rejected.Load(),
+	}
+}
+
+// Close перестаёт принимать запросы и дожидается обработки уже принятых
+func (q *DeletionQueue) Close() error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	return nil
+}
+
+func (q *DeletionQueue) worker() {
+	defer q.wg.Done()
+
+	for deletion := range q.queue {
+		batch := newDeletionBatch()
+		batch.add(deletion)
+
+	drain:
+		for batch.size < q.opts.BatchSize {
+			select {
+			case next, ok := <-q.queue:
+				if !ok {
+					break drain
+				}
+				batch.add(next)
+			default:
+				break drain
+			}
+		}
+
+		q.process(batch)
+	}
+}
+
+func (q *DeletionQueue) process(batch *deletionBatch) {
+	deletions := batch.deletions()
+	backoff := q.opts.RetryBackoff
+	log := batch.logger()
+
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
+		err := q.storage.DeleteURLsBatch(ctx, deletions)
+		cancel()
+
+		if err == nil {
+			q.deleted.Add(int64(batch.size))
+			return
+		}
+
+		if !IsTransient(err) || attempt >= q.opts.MaxRetries {
+			q.failed.Add(int64(batch.size))
+			log.Errorf("Failed to delete %d URLs of %d users: %v", batch.size, len(deletions), err)
+			return
+		}
+
+		q.retried.Add(1)
+		log.Warnf("Retrying deletion of %d URLs after %v: %v", batch.size, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// deletionBatch объединяет запросы одного пользователя и убирает повторы ссылок
+type deletionBatch struct {
+	byUser     map[string]map[string]struct{}
+	requestIDs []string
+	size       int
+}
+
+func newDeletionBatch() *deletionBatch {
+	return &deletionBatch{byUser: make(map[string]map[string]struct{})}
+}
+
+func (b *deletionBatch) add(deletion models.Deletion) {
+	if deletion.RequestID != "" {
+		b.requestIDs = append(b.requestIDs, deletion.RequestID)
+	}
+	keys, exists := b.byUser[deletion.UserID]
+	if !exists {
+		keys = make(map[string]struct{})
+		b.byUser[deletion.UserID] = keys
+	}
+	for _, shortURL := range deletion.ShortURLs {
+		if _, seen := keys[shortURL]; !seen {
+			keys[shortURL] = struct{}{}
+			b.size++
+		}
+	}
+}
+
+func (b *deletionBatch) deletions() []models.Deletion {
+	deletions := make([]models.Deletion, 0, len(b.byUser))
+	for userID, keys := range b.byUser {
+		deletion := models.Deletion{UserID: userID, ShortURLs: make([]string, 0, len(keys))}
+		for shortURL := range keys {
+			deletion.ShortURLs = append(deletion.ShortURLs, shortURL)
+		}
+		deletions = append(deletions, deletion)
+	}
+	return deletions
+}
+
+// logger возвращает логгер с идентификаторами запросов и пользователей пачки,
+// чтобы фоновые ошибки можно было связать с исходными запросами
+func (b *deletionBatch) logger() *zap.SugaredLogger {
+	userIDs := make([]string, 0, len(b.byUser))
+	for userID := range b.byUser {
+		userIDs = append(userIDs, userID)
+	}
+	return logger.Sugar.With("request_ids", b.requestIDs, "user_ids", userIDs)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+)
+
+// flakyStorage отвечает временной ошибкой на первые failures вызовов
+type flakyStorage struct {
+	*MemoryStorage
+
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (s *flakyStorage) DeleteURLsBatch(ctx context.Context, deletions []models.Deletion) error {
+	s.mu.Lock()
+	s.calls++
+	fail := s.calls <= s.failures
+	s.mu.Unlock()
+
+	if fail {
+		return driver.ErrBadConn
+	}
+	return s.MemoryStorage.DeleteURLsBatch(ctx, deletions)
+}
+
+func TestDeletionQueue(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+
+	memory, _ := NewMemoryStorage(ctx)
+	memory.SaveManyURLS(ctx, []models.URL{
+		{UserID: "alice", ShortURL: "a1", OriginalURL: "http://a1.com"},
+		{UserID: "alice", ShortURL: "a2", OriginalURL: "http://a2.com"},
+		{UserID: "bob", ShortURL: "b1", OriginalURL: "http://b1.com"},
+	})
+	storage := &flakyStorage{MemoryStorage: memory, failures: 2}
+
+	queue := NewDeletionQueue(storage, DeletionQueueOptions{
+		Workers:      1,
+		QueueSize:    10,
+		RetryBackoff: time.Millisecond,
+	})
+
+	requests := []models.Deletion{
+		{UserID: "alice", ShortURLs: []string{"a1"}},
+		{UserID: "alice", ShortURLs: []string{"a1", "a2"}},
+		{UserID: "bob", ShortURLs: []string{"b1", "a1"}},
+	}
+	for _, deletion := range requests {
+		if err := queue.Enqueue(deletion); err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+	}
+
+	if err := queue.Close(); err != nil {
+		t.Fatalf("failed to close queue: %v", err)
+	}
+	if err := queue.Enqueue(requests[0]); !errors.Is(err, ErrDeletionQueueClosed) {
+		t.Errorf("expected ErrDeletionQueueClosed after Close, got %v", err)
+	}
+
+	for _, short := range []string{"a1", "a2", "b1"} {
+		if _, err := memory.GetLongURL(ctx, short); !errors.Is(err, ErrGone) {
+			t.Errorf("expected %s to be deleted, got %v", short, err)
+		}
+	}
+
+	stats := queue.Stats()
+	if stats.Retried != 2 || stats.Failed != 0 || stats.QueueDepth != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDeletionQueueFull(t *testing.T) {
+	ctx := context.Background()
+	memory, _ := NewMemoryStorage(ctx)
+
+	// Без обработчиков очередь никто не разбирает; Close не вызываем,
+	// чтобы не ждать их завершения
+	queue := &DeletionQueue{storage: memory, queue: make(chan models.Deletion, 1)}
+
+	if err := queue.Enqueue(models.Deletion{UserID: "alice", ShortURLs: []string{"a1"}}); err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+	if err := queue.Enqueue(models.Deletion{UserID: "alice", ShortURLs: []string{"a2"}}); !errors.Is(err, ErrDeletionQueueFull) {
+		t.Errorf("expected ErrDeletionQueueFull, got %v", err)
+	}
+	if stats := queue.Stats(); stats.Rejected != 1 || stats.QueueDepth != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
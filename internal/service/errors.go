@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Ошибки хранилищ. Реализации Storage оборачивают в них свои ошибки, чтобы
+// вызывающий код различал исходы через errors.Is, не зная бэкенда.
+var (
+	// ErrConflict — запись противоречит уже сохранённой
+	ErrConflict = errors.New("conflict")
+	// ErrNotFound — записи нет
+	ErrNotFound = errors.New("not found")
+	// ErrGone — запись была, но удалена или истекла
+	ErrGone = errors.New("gone")
+	// ErrUnavailable — бэкенд временно недоступен, запрос можно повторить позже
+	ErrUnavailable = errors.New("storage is unavailable")
+)
+
+// ErrShortURLExists возвращается при сохранении уже занятой короткой ссылки
+var ErrShortURLExists = fmt.Errorf("%w: short url already exists", ErrConflict)
+
+// DuplicateURLError возвращается, если оригинальный URL уже сокращён;
+// ShortURL — существующая короткая ссылка на него
+type DuplicateURLError struct {
+	ShortURL string
+}
+
+func (e *DuplicateURLError) Error() string {
+	return fmt.Sprintf("original url is already shortened as %s", e.ShortURL)
+}
+
+// Is делает DuplicateURLError разновидностью ErrConflict
+func (e *DuplicateURLError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// dbError оборачивает ошибку БД операции op, помечая сбои соединения ErrUnavailable
+func dbError(op string, err error) error {
+	if IsTransient(err) {
+		return fmt.Errorf("failed to %s: %w: %w", op, ErrUnavailable, err)
+	}
+	return fmt.Errorf("failed to %s: %w", op, err)
+}
+
+// IsTransient сообщает, имеет ли смысл повторить операцию, завершившуюся err
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrUnavailable) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgerrcode.SerializationFailure,
+			pgerrcode.DeadlockDetected,
+			pgerrcode.TooManyConnections,
+			pgerrcode.AdminShutdown,
+			pgerrcode.CannotConnectNow:
+			return true
+		}
+		return pgerrcode.IsConnectionException(pgErr.Code)
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
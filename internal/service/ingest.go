@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+)
+
+// Значения по умолчанию для ClickPipelineOptions
+const (
+	defaultClickQueueSize     = 10000
+	defaultClickBatchSize     = 500
+	defaultClickFlushInterval = time.Second
+	clickFlushTimeout         = 5 * time.Second
+)
+
+type ClickPipelineOptions struct {
+	// QueueSize — ёмкость очереди; при заполнении новые переходы отбрасываются
+	QueueSize int
+	// BatchSize — размер пачки, при котором очередь сбрасывается в хранилище
+	BatchSize int
+	// FlushInterval — максимальное время ожидания неполной пачки
+	FlushInterval time.Duration
+}
+
+// ClickPipeline принимает переходы в ограниченную очередь и пачками пишет их
+// в store. Запись в очередь никогда не блокирует: при переполнении переход
+// отбрасывается и учитывается в Dropped.
+type ClickPipeline struct {
+	store ClickStore
+	opts  ClickPipelineOptions
+
+	// mu защищает закрытие очереди от конкурентной записи в неё
+	mu     sync.RWMutex
+	closed bool
+	queue  chan models.Click
+	done   chan struct{}
+
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	reported int64
+}
+
+func NewClickPipeline(store ClickStore, opts ClickPipelineOptions) *ClickPipeline {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultClickQueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultClickBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultClickFlushInterval
+	}
+
+	p := &ClickPipeline{
+		store: store,
+		opts:  opts,
+		queue: make(chan models.Click, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go p.run()
+
+	return p
+}
+
+// SaveClicks ставит переходы в очередь и сразу возвращает управление
+func (p *ClickPipeline) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(int64(len(clicks)))
+		return nil
+	}
+
+	for _, click := range clicks {
+		select {
+		case p.queue <- click:
+		default:
+			p.dropped.Add(1)
+		}
+	}
+
+	return nil
+}
+
+func (p *ClickPipeline) GetClickStats(ctx context.Context, shortURL string, recent int) (models.ClickStats, error) {
+	return p.store.GetClickStats(ctx, shortURL, recent)
+}
+
+// Dropped возвращает число переходов, отброшенных из-за переполнения очереди
+func (p *ClickPipeline) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Failed возвращает число переходов, которые не удалось записать в хранилище
+func (p *ClickPipeline) Failed() int64 {
+	return p.failed.Load()
+}
+
+// QueueDepth возвращает текущее число переходов в очереди
+func (p *ClickPipeline) QueueDepth() int {
+	return len(p.queue)
+}
+
+// Close перестаёт принимать переходы, сбрасывает остаток очереди и закрывает store
+func (p *ClickPipeline) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	<-p.done
+	return p.store.Close()
+}
+
+func (p *ClickPipeline) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.Click, 0, p.opts.BatchSize)
+	for {
+		select {
+		case click, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= p.opts.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			p.flush(batch)
+			batch = batch[:0]
+			p.reportDropped()
+		}
+	}
+}
+
+func (p *ClickPipeline) flush(batch []models.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clickFlushTimeout)
+	defer cancel()
+
+	if err := p.store.SaveClicks(ctx, batch); err != nil {
+		p.failed.Add(int64(len(batch)))
+		logger.Sugar.Errorf("Failed to save %d clicks: %v", len(batch), err)
+	}
+}
+
+// reportDropped пишет в лог, сколько переходов отброшено с прошлого отчёта
+func (p *ClickPipeline) reportDropped() {
+	dropped := p.dropped.Load()
+	if dropped == p.reported {
+		return
+	}
+	logger.Sugar.Warnf("Click queue is full: dropped %d clicks", dropped-p.reported)
+	p.reported = dropped
+}
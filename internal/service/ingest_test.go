@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/linarium/shortener/internal/models"
+)
+
+// blockingClickStore не даёт конвейеру сбросить пачку, пока не закрыт release
+type blockingClickStore struct {
+	*MemoryClickStore
+	release chan struct{}
+}
+
+func (s *blockingClickStore) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	<-s.release
+	return s.MemoryClickStore.SaveClicks(ctx, clicks)
+}
+
+func TestClickPipeline(t *testing.T) {
+	ctx := context.Background()
+	store := &blockingClickStore{MemoryClickStore: NewMemoryClickStore(), release: make(chan struct{})}
+
+	pipeline := NewClickPipeline(store, ClickPipelineOptions{
+		QueueSize:     2,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	})
+
+	// Первый переход забирает писатель и зависает на store, следующие два
+	// заполняют очередь, остальные должны отбрасываться без блокировки
+	click := models.Click{ShortURL: "aaa", Timestamp: time.Now()}
+	pipeline.SaveClicks(ctx, []models.Click{click})
+	for pipeline.QueueDepth() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pipeline.SaveClicks(ctx, []models.Click{click, click, click, click})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("SaveClicks blocked on a full queue")
+	}
+
+	if dropped := pipeline.Dropped(); dropped != 2 {
+		t.Errorf("expected 2 dropped clicks, got %d", dropped)
+	}
+
+	close(store.release)
+	if err := pipeline.Close(); err != nil {
+		t.Fatalf("failed to close pipeline: %v", err)
+	}
+
+	stats, err := store.GetClickStats(ctx, "aaa", 10)
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Total != 3 {
+		t.Errorf("expected 3 clicks flushed on close, got %d", stats.Total)
+	}
+}
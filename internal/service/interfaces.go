@@ -2,6 +2,10 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"time"
+
 	"github.com/linarium/shortener/internal/config"
 	"github.com/linarium/shortener/internal/models"
 )
@@ -12,41 +16,83 @@ func NewStorage(ctx context.Context, cfg config.Config) (Storage, error) {
 	}
 
 	if cfg.FileStoragePath != "" {
-		return NewFileStorage(cfg.FileStoragePath)
+		opts, err := fileStorageOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewFileStorage(cfg.FileStoragePath, opts)
 	}
 
 	return NewMemoryStorage(ctx)
 }
 
+// fileStorageOptions собирает параметры файлов хранилища из конфигурации
+func fileStorageOptions(cfg config.Config) (FileStorageOptions, error) {
+	syncPolicy, err := ParseSyncPolicy(cfg.FileSync)
+	if err != nil {
+		return FileStorageOptions{}, err
+	}
+	return FileStorageOptions{
+		CompactRecords: cfg.FileCompactRecords,
+		CompactSize:    cfg.FileCompactSize,
+		Strict:         cfg.FileStorageStrict,
+		Sync:           syncPolicy,
+		SyncInterval:   cfg.FileSyncInterval,
+	}, nil
+}
+
+// Storage хранит ссылки. Ошибки методов оборачивают ErrConflict, ErrNotFound,
+// ErrGone или ErrUnavailable, если исход подходит под одну из них.
 type Storage interface {
+	// SaveShortURL возвращает ErrShortURLExists, если короткая ссылка занята,
+	// и *DuplicateURLError, если оригинальный URL уже сокращён
 	SaveShortURL(ctx context.Context, model models.URL) error
 	SaveManyURLS(ctx context.Context, models []models.URL) error
 	GetAll(ctx context.Context, userID string) ([]models.URL, error)
-	GetLongURL(ctx context.Context, short string) (string, bool, bool)
-	FindShortURLByOriginal(ctx context.Context, original string) (string, bool)
+	// GetLongURL возвращает ErrNotFound для неизвестной ссылки и ErrGone для
+	// удалённой или истёкшей
+	GetLongURL(ctx context.Context, short string) (string, error)
+	// GetURLInfo возвращает ссылку в любом состоянии или ErrNotFound
+	GetURLInfo(ctx context.Context, short string) (*models.URL, error)
+	FindShortURLByOriginal(ctx context.Context, original string) (string, error)
 	Ping(ctx context.Context) error
 	Close() error
 	DeleteURLs(ctx context.Context, userID string, shortURLs []string) error
+	// DeleteURLsBatch удаляет ссылки нескольких пользователей за одну операцию
+	DeleteURLsBatch(ctx context.Context, deletions []models.Deletion) error
+	MarkExpired(ctx context.Context, now time.Time) (int, error)
+	// Stats считает неудалённые ссылки и пользователей, которым они принадлежат
+	Stats(ctx context.Context) (models.Stats, error)
 }
 
-func (s *DBStorage) FindShortURLByOriginal(ctx context.Context, original string) (string, bool) {
+// FindShortURLByOriginal ищет действующую ссылку на original. Удалённые и
+// истёкшие ссылки не мешают сократить тот же URL заново.
+func (s *DBStorage) FindShortURLByOriginal(ctx context.Context, original string) (string, error) {
 	var short string
-	err := s.db.QueryRowxContext(ctx, `SELECT short_url FROM urls WHERE original_url = $1 LIMIT 1`, original).Scan(&short)
+	err := s.db.QueryRowxContext(ctx, `
+        SELECT short_url FROM urls WHERE original_url = $1 AND NOT is_deleted LIMIT 1
+    `, original).Scan(&short)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
 	if err != nil {
-		return "", false
+		return "", dbError("find URL", err)
 	}
-	return short, true
+	return short, nil
 }
 
-func (s *MemoryStorage) FindShortURLByOriginal(ctx context.Context, original string) (string, bool) {
+func (s *MemoryStorage) FindShortURLByOriginal(ctx context.Context, original string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	for k, v := range s.data {
-		if v == original {
-			return k, true
+		if v.OriginalURL == original && !v.IsDeleted {
+			return k, nil
 		}
 	}
-	return "", false
+	return "", ErrNotFound
 }
 
-func (s *FileStorage) FindShortURLByOriginal(ctx context.Context, original string) (string, bool) {
+func (s *FileStorage) FindShortURLByOriginal(ctx context.Context, original string) (string, error) {
 	return s.memory.FindShortURLByOriginal(ctx, original)
 }
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package service
+
+import "os"
+
+// lockFile на платформах без flock только создаёт файл блокировки
+func lockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+func unlockFile(file *os.File) error {
+	return file.Close()
+}
+
+// syncDir на платформах без fsync каталога ничего не делает
+func syncDir(dir string) error {
+	return nil
+}
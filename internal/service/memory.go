@@ -2,37 +2,75 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/linarium/shortener/internal/models"
 )
 
 type MemoryStorage struct {
-	data map[string]string
+	data map[string]models.URL
 	mu   sync.RWMutex
+
+	// live и owners — число неудалённых ссылок всего и по владельцам,
+	// поддерживаются при каждом изменении data для быстрого Stats
+	live   int
+	owners map[string]int
 }
 
 func NewMemoryStorage(ctx context.Context) (*MemoryStorage, error) {
-	return &MemoryStorage{data: make(map[string]string)}, nil
+	return newMemoryStorageFrom(make(map[string]models.URL)), nil
+}
+
+// newMemoryStorageFrom создаёт хранилище поверх восстановленных записей
+func newMemoryStorageFrom(data map[string]models.URL) *MemoryStorage {
+	s := &MemoryStorage{data: data, owners: make(map[string]int)}
+	for _, model := range data {
+		if !model.IsDeleted {
+			s.live++
+			s.owners[model.UserID]++
+		}
+	}
+	return s
 }
 
 func (s *MemoryStorage) SaveShortURL(ctx context.Context, model models.URL) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[model.ShortURL] = model.OriginalURL
+	if _, exists := s.data[model.ShortURL]; exists {
+		return fmt.Errorf("%w: %s", ErrShortURLExists, model.ShortURL)
+	}
+	s.insert(model)
 	return nil
 }
 
-func (s *MemoryStorage) GetLongURL(ctx context.Context, short string) (string, bool, bool) {
+func (s *MemoryStorage) GetLongURL(ctx context.Context, short string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	model, exists := s.data[short]
+	if !exists {
+		return "", ErrNotFound
+	}
+
+	if model.IsDeleted || model.IsExpired(time.Now()) {
+		return "", ErrGone
+	}
+
+	return model.OriginalURL, nil
+}
+
+func (s *MemoryStorage) GetURLInfo(ctx context.Context, short string) (*models.URL, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	long, exists := s.data[short]
+	model, exists := s.data[short]
 	if !exists {
-		return "", false, false
+		return nil, ErrNotFound
 	}
 
-	return long, true, false
+	return &model, nil
 }
 
 func (s *MemoryStorage) Close() error {
@@ -42,8 +80,19 @@ func (s *MemoryStorage) Close() error {
 func (s *MemoryStorage) SaveManyURLS(ctx context.Context, models []models.URL) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+
+	// Пакет сохраняется целиком или не сохраняется вовсе, как в транзакции
+	batch := make(map[string]struct{}, len(models))
 	for _, model := range models {
-		s.data[model.ShortURL] = model.OriginalURL
+		_, inBatch := batch[model.ShortURL]
+		if _, exists := s.data[model.ShortURL]; exists || inBatch {
+			return fmt.Errorf("%w: %s", ErrShortURLExists, model.ShortURL)
+		}
+		batch[model.ShortURL] = struct{}{}
+	}
+
+	for _, model := range models {
+		s.insert(model)
 	}
 	return nil
 }
@@ -53,23 +102,151 @@ func (s *MemoryStorage) GetAll(ctx context.Context, userID string) ([]models.URL
 	defer s.mu.RUnlock()
 
 	var urls []models.URL
-	for shortURL, originalURL := range s.data {
-		urls = append(urls, models.URL{
-			ShortURL:    shortURL,
-			OriginalURL: originalURL,
-		})
+	for _, model := range s.data {
+		if model.UserID != userID || model.IsDeleted {
+			continue
+		}
+		urls = append(urls, model)
 	}
 
 	return urls, nil
 }
 
+// DeleteURLs помечает удалёнными только те ссылки, которые принадлежат userID
 func (s *MemoryStorage) DeleteURLs(ctx context.Context, userID string, shortURLs []string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for _, shortURL := range shortURLs {
-		delete(s.data, shortURL)
+		model, exists := s.data[shortURL]
+		if !exists || model.UserID != userID {
+			continue
+		}
+		s.setDeleted(model)
 	}
 
 	return nil
 }
+
+func (s *MemoryStorage) DeleteURLsBatch(ctx context.Context, deletions []models.Deletion) error {
+	for _, deletion := range deletions {
+		if err := s.DeleteURLs(ctx, deletion.UserID, deletion.ShortURLs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkExpired помечает удалёнными ссылки, срок действия которых истёк к now
+func (s *MemoryStorage) MarkExpired(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	marked := 0
+	for _, model := range s.data {
+		if model.IsDeleted || !model.IsExpired(now) {
+			continue
+		}
+		s.setDeleted(model)
+		marked++
+	}
+
+	return marked, nil
+}
+
+// Stats возвращает число неудалённых ссылок и их владельцев
+func (s *MemoryStorage) Stats(ctx context.Context) (models.Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return models.Stats{URLs: s.live, Users: len(s.owners)}, nil
+}
+
+// insert вызывается под s.mu
+func (s *MemoryStorage) insert(model models.URL) {
+	s.data[model.ShortURL] = model
+	if !model.IsDeleted {
+		s.live++
+		s.owners[model.UserID]++
+	}
+}
+
+// setDeleted вызывается под s.mu
+func (s *MemoryStorage) setDeleted(model models.URL) {
+	if model.IsDeleted {
+		return
+	}
+	model.IsDeleted = true
+	s.data[model.ShortURL] = model
+
+	s.live--
+	if s.owners[model.UserID]--; s.owners[model.UserID] == 0 {
+		delete(s.owners, model.UserID)
+	}
+}
+
+// expiredURLs возвращает ещё не удалённые ссылки с истёкшим сроком действия
+func (s *MemoryStorage) expiredURLs(now time.Time) []models.URL {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var expired []models.URL
+	for _, model := range s.data {
+		if !model.IsDeleted && model.IsExpired(now) {
+			expired = append(expired, model)
+		}
+	}
+	return expired
+}
+
+// markDeleted помечает удалёнными ссылки независимо от владельца
+func (s *MemoryStorage) markDeleted(shortURLs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, shortURL := range shortURLs {
+		if model, exists := s.data[shortURL]; exists {
+			s.setDeleted(model)
+		}
+	}
+}
+
+// ownedURLs возвращает ещё не удалённые ссылки из shortURLs, принадлежащие userID
+func (s *MemoryStorage) ownedURLs(userID string, shortURLs []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var owned []string
+	for _, shortURL := range shortURLs {
+		model, exists := s.data[shortURL]
+		if exists && model.UserID == userID && !model.IsDeleted {
+			owned = append(owned, shortURL)
+		}
+	}
+	return owned
+}
+
+// snapshot возвращает копию всех записей, включая удалённые
+func (s *MemoryStorage) snapshot() []models.URL {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	urls := make([]models.URL, 0, len(s.data))
+	for _, model := range s.data {
+		urls = append(urls, model)
+	}
+	return urls
+}
+
+func (s *MemoryStorage) count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+func (s *MemoryStorage) exists(short string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.data[short]
+	return exists
+}
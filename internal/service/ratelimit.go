@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/linarium/shortener/internal/config"
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/ratelimit"
+)
+
+const (
+	// rateLimitIdleTTL — через сколько простоя корзина удаляется из таблицы.
+	// Лимиты с периодом дольше суток после такого простоя начинаются заново.
+	rateLimitIdleTTL = 24 * time.Hour
+	// rateLimitSweepInterval — как часто удаляются простаивающие корзины
+	rateLimitSweepInterval = time.Hour
+)
+
+// NewRateLimitStore возвращает хранилище корзин. Общие для нескольких экземпляров
+// счётчики в Postgres используются, только если они включены и storage — БД.
+func NewRateLimitStore(cfg config.Config, storage Storage) ratelimit.Store {
+	if dbStorage, ok := storage.(*DBStorage); ok && cfg.RateLimitShared {
+		return &DBRateLimitStore{db: dbStorage.db}
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+// DBRateLimitStore хранит корзины в таблице rate_limits и использует пул DBStorage
+type DBRateLimitStore struct {
+	db        DB
+	lastSweep atomic.Int64
+}
+
+// Take пополняет и расходует корзину одним UPSERT, поэтому одновременные
+// запросы с разных экземпляров не могут взять один и тот же токен дважды
+func (s *DBRateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	now := time.Now()
+	s.sweep(ctx, now)
+
+	var tokens float64
+	var allowed bool
+	err := s.db.QueryRowxContext(ctx, `
+        INSERT INTO rate_limits AS r (key, tokens, allowed, updated_at)
+        VALUES ($1, $2::float8 - 1, TRUE, $3)
+        ON CONFLICT (key) DO UPDATE SET (tokens, allowed, updated_at) = (
+            SELECT
+                CASE WHEN refilled >= 1 THEN refilled - 1 ELSE refilled END,
+                refilled >= 1,
+                GREATEST(r.updated_at, $3)
+            FROM (
+                SELECT LEAST($2::float8, r.tokens +
+                    GREATEST(0, EXTRACT(EPOCH FROM ($3 - r.updated_at))::float8) * $4::float8) AS refilled
+            ) AS bucket
+        )
+        RETURNING tokens, allowed
+    `, key, float64(limit.Requests), now, float64(limit.Requests)/limit.Period.Seconds()).Scan(&tokens, &allowed)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return ratelimit.NewResult(limit, tokens, allowed), nil
+}
+
+// sweep не чаще rateLimitSweepInterval удаляет давно не использованные корзины
+func (s *DBRateLimitStore) sweep(ctx context.Context, now time.Time) {
+	last := s.lastSweep.Load()
+	if now.UnixNano()-last < int64(rateLimitSweepInterval) || !s.lastSweep.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE updated_at < $1`, now.Add(-rateLimitIdleTTL))
+	if err != nil {
+		logger.FromContext(ctx).Warnf("Failed to remove idle rate limit buckets: %v", err)
+	}
+}
+
+// Close ничего не делает: пулом соединений владеет DBStorage
+func (s *DBRateLimitStore) Close() error {
+	return nil
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+)
+
+// RunExpirationReaper периодически помечает удалёнными ссылки с истёкшим
+// сроком действия, пока не будет отменён ctx
+func RunExpirationReaper(ctx context.Context, storage Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			marked, err := storage.MarkExpired(ctx, now)
+			if err != nil {
+				logger.Sugar.Errorf("Failed to mark expired URLs: %v", err)
+				continue
+			}
+			if marked > 0 {
+				logger.Sugar.Infof("Marked %d expired URLs as deleted", marked)
+			}
+		}
+	}
+}
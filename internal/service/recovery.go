@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+)
+
+// quarantineSuffix — суффикс файла, куда откладываются повреждённые записи журнала
+const quarantineSuffix = ".quarantine"
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// encodeRecord сериализует запись в строку журнала с контрольной суммой.
+// Сумма считается по JSON самой записи с пустым полем crc.
+func encodeRecord(record fileRecord) ([]byte, error) {
+	record.Checksum = 0
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Checksum = crc32.ChecksumIEEE(payload)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// parseRecord разбирает строку журнала и проверяет её контрольную сумму.
+// Записи без суммы, оставшиеся от старых версий, принимаются без проверки.
+func parseRecord(line []byte) (*fileRecord, error) {
+	record := &fileRecord{}
+	if err := json.Unmarshal(line, record); err != nil {
+		return nil, err
+	}
+
+	switch record.Op {
+	case "", opCreate, opDelete:
+	default:
+		return nil, fmt.Errorf("unknown record op %q", record.Op)
+	}
+
+	if record.Checksum == 0 {
+		return record, nil
+	}
+
+	sum := record.Checksum
+	record.Checksum = 0
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, errChecksumMismatch
+	}
+	record.Checksum = sum
+
+	return record, nil
+}
+
+// logState — результат чтения журнала FileStorage
+type logState struct {
+	data    map[string]models.URL
+	records int
+}
+
+// recoverLog читает журнал и восстанавливает по нему состояние хранилища
+func recoverLog(path string, strict bool) (*logState, error) {
+	state := &logState{data: make(map[string]models.URL)}
+
+	records, err := recoverLines(path, strict, func(line []byte) error {
+		record, err := parseRecord(line)
+		if err != nil {
+			return err
+		}
+		replayRecord(state.data, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	state.records = records
+
+	return state, nil
+}
+
+// recoverLines читает JSONL-журнал path и передаёт каждую строку в apply.
+// Строка, на которой apply вернул ошибку, считается повреждённой; apply не
+// должен применять такие строки. В нестрогом режиме оборванная последняя
+// запись без перевода строки отрезается, а остальные повреждённые записи
+// переносятся в файл <path>.quarantine. В строгом режиме любая повреждённая
+// запись прерывает загрузку. Возвращает число принятых записей.
+func recoverLines(path string, strict bool, apply func(line []byte) error) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var (
+		reader     = bufio.NewReader(file)
+		offset     int64
+		goodEnd    int64
+		accepted   int
+		corrupt    [][]byte
+		corruptAt  = make(map[int64]struct{})
+		torn       bool
+		missingEOL bool
+	)
+
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		start := offset
+		offset += int64(len(line))
+		// Без перевода строки может быть только последняя строка файла
+		complete := line[len(line)-1] == '\n'
+
+		if applyErr := apply(bytes.TrimSuffix(line, []byte("\n"))); applyErr != nil {
+			if strict {
+				return 0, fmt.Errorf("corrupt record at %s:%d: %w", path, lineNo, applyErr)
+			}
+			corrupt = append(corrupt, line)
+			corruptAt[start] = struct{}{}
+			torn = !complete
+		} else {
+			accepted++
+			goodEnd = offset
+			torn = false
+			missingEOL = !complete
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	// Недописанный хвост после сбоя — последняя повреждённая запись без
+	// перевода строки. Целая строка с неверной суммой уходит в карантин.
+	if torn {
+		tail := corrupt[len(corrupt)-1]
+		corrupt = corrupt[:len(corrupt)-1]
+		logger.Sugar.Warnf("Truncating torn record at the end of %s (%d bytes)", path, len(tail))
+	}
+
+	if len(corrupt) > 0 {
+		if err := quarantineRecords(path, corrupt); err != nil {
+			return 0, err
+		}
+		logger.Sugar.Warnf("Moved %d corrupt records from %s to %s", len(corrupt), path, path+quarantineSuffix)
+
+		// Переписываем журнал только из проверенных записей
+		file.Close()
+		if err := rewriteValidRecords(path, corruptAt); err != nil {
+			return 0, err
+		}
+		return accepted, nil
+	}
+
+	if torn {
+		if err := os.Truncate(path, goodEnd); err != nil {
+			return 0, fmt.Errorf("failed to truncate torn record: %w", err)
+		}
+	}
+
+	if missingEOL {
+		if err := appendToFile(path, []byte("\n")); err != nil {
+			return 0, err
+		}
+	}
+
+	return accepted, nil
+}
+
+func quarantineRecords(path string, lines [][]byte) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(bytes.TrimSuffix(line, []byte("\n")))
+		buf.WriteByte('\n')
+	}
+	if err := appendToFile(path+quarantineSuffix, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to quarantine corrupt records: %w", err)
+	}
+	return nil
+}
+
+func appendToFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rewriteValidRecords атомарно заменяет журнал копией без строк,
+// начинающихся со смещений из corruptAt
+func rewriteValidRecords(path string, corruptAt map[int64]struct{}) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".recover-*")
+	if err != nil {
+		return fmt.Errorf("failed to create recovery file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	reader := bufio.NewReader(src)
+	writer := bufio.NewWriter(tmp)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) > 0 {
+			start := offset
+			offset += int64(len(line))
+			if _, skip := corruptAt[start]; !skip {
+				writer.Write(bytes.TrimSuffix(line, []byte("\n")))
+				writer.WriteByte('\n')
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write recovery file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync recovery file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace log: %w", err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed to sync log directory: %w", err)
+	}
+	return nil
+}
+
+// replaceLog подменяет журнал path подготовленным файлом tmpPath и возвращает
+// дескриптор нового журнала для дозаписи. Дескриптор открывается до
+// переименования, поэтому при ошибке вызывающий продолжает писать в прежний
+// файл. Запись каталога сбрасывается на диск отдельно через syncDir.
+func replaceLog(tmpPath, path string, flag int) (*os.File, error) {
+	file, err := os.OpenFile(tmpPath, flag|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open new log: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to replace log: %w", err)
+	}
+	return file, nil
+}
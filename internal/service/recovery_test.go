@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+)
+
+func writeLog(t *testing.T, path string, records []fileRecord, tail string) {
+	t.Helper()
+
+	var content []byte
+	for _, record := range records {
+		line, err := encodeRecord(record)
+		if err != nil {
+			t.Fatalf("failed to encode record: %v", err)
+		}
+		content = append(content, line...)
+	}
+	content = append(content, tail...)
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+}
+
+func TestRecoverLog(t *testing.T) {
+	logger.Initialize()
+
+	first := fileRecord{Op: opCreate, URL: models.URL{ID: "1", UserID: "u", ShortURL: "aaa", OriginalURL: "http://a.com"}}
+	second := fileRecord{Op: opCreate, URL: models.URL{ID: "2", UserID: "u", ShortURL: "bbb", OriginalURL: "http://b.com"}}
+
+	tampered, err := encodeRecord(second)
+	if err != nil {
+		t.Fatalf("failed to encode record: %v", err)
+	}
+	tamperedLine := strings.Replace(string(tampered), "http://b.com", "http://evil.com", 1)
+
+	tests := []struct {
+		name            string
+		records         []fileRecord
+		tail            string
+		strict          bool
+		wantErr         bool
+		wantKeys        []string
+		wantQuarantined int
+	}{
+		{
+			name:     "Torn tail is truncated",
+			records:  []fileRecord{first, second},
+			tail:     `{"op":"create","ID":"3","Short`,
+			wantKeys: []string{"aaa", "bbb"},
+		},
+		{
+			name:            "Corrupt middle record is quarantined",
+			records:         []fileRecord{first},
+			tail:            tamperedLine + `{"op":"create","ID":"3","ShortURL":"ccc","OriginalURL":"http://c.com"}` + "\n",
+			wantKeys:        []string{"aaa", "ccc"},
+			wantQuarantined: 1,
+		},
+		{
+			name:            "Complete last record with bad checksum is quarantined",
+			records:         []fileRecord{first},
+			tail:            tamperedLine,
+			wantKeys:        []string{"aaa"},
+			wantQuarantined: 1,
+		},
+		{
+			name:    "Strict mode fails on torn tail",
+			records: []fileRecord{first},
+			tail:    `{"op":"create"`,
+			strict:  true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "shortener.json")
+			writeLog(t, path, tt.records, tt.tail)
+
+			storage, err := NewFileStorage(path, FileStorageOptions{Strict: tt.strict})
+			if tt.wantErr {
+				if err == nil {
+					storage.Close()
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer storage.Close()
+
+			if count := storage.memory.count(); count != len(tt.wantKeys) {
+				t.Errorf("expected %d records, got %d", len(tt.wantKeys), count)
+			}
+			for _, key := range tt.wantKeys {
+				if _, err := storage.GetLongURL(context.Background(), key); errors.Is(err, ErrNotFound) {
+					t.Errorf("expected %s to be loaded", key)
+				}
+			}
+
+			quarantined, _ := os.ReadFile(path + quarantineSuffix)
+			if lines := strings.Count(string(quarantined), "\n"); lines != tt.wantQuarantined {
+				t.Errorf("expected %d quarantined records, got %d", tt.wantQuarantined, lines)
+			}
+
+			// Файл после починки должен загружаться в строгом режиме
+			if _, err := recoverLog(path, true); err != nil {
+				t.Errorf("expected repaired log to pass strict load: %v", err)
+			}
+		})
+	}
+}
+
+func TestReplaceLogKeepsOldLogOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	tmpPath := filepath.Join(dir, "log.compact")
+	if err := os.WriteFile(tmpPath, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Непустой каталог на месте журнала не даёт выполнить переименование
+	path := filepath.Join(dir, "log")
+	if err := os.MkdirAll(filepath.Join(path, "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if file, err := replaceLog(tmpPath, path, os.O_RDWR); err == nil {
+		file.Close()
+		t.Fatal("expected replaceLog to fail")
+	}
+
+	path = filepath.Join(dir, "log.json")
+	file, err := replaceLog(tmpPath, path, os.O_RDWR)
+	if err != nil {
+		t.Fatalf("replaceLog failed: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString("appended\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new\nappended\n" {
+		t.Errorf("writes must go to the replaced log, got %q", content)
+	}
+}
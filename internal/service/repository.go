@@ -3,82 +3,401 @@ package service
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/linarium/shortener/internal/logger"
 	"github.com/linarium/shortener/internal/models"
 )
 
+// Типы записей в журнале FileStorage
+const (
+	opCreate = "create"
+	opDelete = "delete"
+)
+
+var (
+	// ErrStorageClosed возвращается при обращении к закрытому хранилищу
+	ErrStorageClosed = fmt.Errorf("%w: storage is closed", ErrUnavailable)
+	// ErrCompactionNotSupported возвращается, если хранилище не умеет уплотняться
+	ErrCompactionNotSupported = errors.New("storage does not support compaction")
+	// ErrStorageLocked возвращается, если файл хранилища открыт другим процессом
+	ErrStorageLocked = errors.New("storage file is locked by another process")
+)
+
+// lockSuffix — суффикс файла рекомендательной блокировки журнала
+const lockSuffix = ".lock"
+
+// fileRecord — строка журнала. Записи без op считаются созданием ссылки,
+// так читаются файлы, записанные до появления удалений.
+type fileRecord struct {
+	Op string `json:"op,omitempty"`
+	models.URL
+	Checksum uint32 `json:"crc,omitempty"`
+}
+
+// FileStorageOptions задаёт пороги автоматического уплотнения журнала
+// и режим загрузки. Нулевое значение порога отключает соответствующую проверку.
+type FileStorageOptions struct {
+	// CompactRecords — число устаревших записей (перезаписанных и tombstone),
+	// после которого журнал уплотняется
+	CompactRecords int
+	// CompactSize — прирост журнала в байтах с момента последнего уплотнения
+	CompactSize int64
+	// Strict запрещает чинить журнал при загрузке: любая повреждённая запись
+	// приводит к ошибке
+	Strict bool
+	// Sync задаёт политику fsync, SyncInterval — её период для SyncInterval
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+}
+
+// Compactor реализуется хранилищами, которые умеют уплотнять свои данные
+type Compactor interface {
+	Compact(ctx context.Context) error
+}
+
 type FileStorage struct {
-	file   *os.File
-	writer *bufio.Writer
+	path   string
+	opts   FileStorageOptions
 	memory *MemoryStorage
+	lock   *os.File
+
+	closeOnce sync.Once
+
+	// Очередь группового писателя, см. runWriter
+	requests   chan *appendRequest
+	stop       chan struct{}
+	writerDone chan struct{}
+
+	// mu защищает файл журнала, буфер записи и счётчики ниже
+	mu         sync.Mutex
+	file       *os.File
+	writer     *bufio.Writer
+	records    int
+	size       int64
+	baseSize   int64
+	dirty      bool
+	compacting bool
+	pending    [][]byte
+	closed     bool
 }
 
-func NewFileStorage(filePath string) (*FileStorage, error) {
+func NewFileStorage(filePath string, opts FileStorageOptions) (*FileStorage, error) {
+	if opts.Sync == "" {
+		opts.Sync = SyncInterval
+	}
+
+	// Блокировка берётся до чтения журнала, чтобы второй процесс
+	// не начал чинить файл, с которым уже работает первый
+	lock, err := lockFile(filePath + lockSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := recoverLog(filePath, opts.Strict)
+	if err != nil {
+		unlockFile(lock)
+		return nil, err
+	}
+
 	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
+		unlockFile(lock)
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		unlockFile(lock)
 		return nil, err
 	}
 
-	data := make(map[string]string)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		model := &models.URL{}
-		if err := json.Unmarshal(scanner.Bytes(), model); err != nil {
+	s := &FileStorage{
+		path:       filePath,
+		opts:       opts,
+		lock:       lock,
+		requests:   make(chan *appendRequest),
+		stop:       make(chan struct{}),
+		writerDone: make(chan struct{}),
+		file:       file,
+		writer:     bufio.NewWriter(file),
+		memory:     newMemoryStorageFrom(state.data),
+		records:    state.records,
+		size:       info.Size(),
+	}
+	go s.runWriter()
+
+	return s, nil
+}
+
+// replayRecord применяет запись журнала к восстанавливаемому состоянию
+func replayRecord(data map[string]models.URL, record *fileRecord) {
+	switch record.Op {
+	case "", opCreate:
+		data[record.ShortURL] = record.URL
+	case opDelete:
+		model, exists := data[record.ShortURL]
+		if !exists || model.UserID != record.UserID {
+			return
+		}
+		model.IsDeleted = true
+		data[record.ShortURL] = model
+	}
+}
+
+func encodeRecords(records []fileRecord) ([][]byte, error) {
+	lines := make([][]byte, len(records))
+	for i, record := range records {
+		line, err := encodeRecord(record)
+		if err != nil {
 			return nil, err
 		}
-		data[model.ShortURL] = model.OriginalURL
+		lines[i] = line
 	}
+	return lines, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+// needsCompaction вызывается под s.mu
+func (s *FileStorage) needsCompaction() bool {
+	if s.opts.CompactRecords > 0 && s.records-s.memory.count() >= s.opts.CompactRecords {
+		return true
+	}
+	if s.opts.CompactSize > 0 && s.size-s.baseSize >= s.opts.CompactSize {
+		return true
 	}
+	return false
+}
 
-	return &FileStorage{
-		file:   file,
-		writer: bufio.NewWriter(file),
-		memory: &MemoryStorage{data: data},
-	}, nil
+func (s *FileStorage) compactInBackground() {
+	if err := s.runCompaction(context.Background()); err != nil {
+		logger.Sugar.Errorf("Failed to compact %s: %v", s.path, err)
+	}
 }
 
-func (s *FileStorage) GetLongURL(ctx context.Context, short string) (string, bool, bool) {
-	return s.memory.GetLongURL(ctx, short)
+// Compact записывает снимок актуальных записей во временный файл и атомарно
+// подменяет им журнал. Запись в хранилище во время уплотнения не блокируется.
+func (s *FileStorage) Compact(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrStorageClosed
+	}
+	if s.compacting {
+		s.mu.Unlock()
+		return nil
+	}
+	s.compacting = true
+	s.mu.Unlock()
+
+	return s.runCompaction(ctx)
 }
 
-func (s *FileStorage) SaveShortURL(ctx context.Context, model models.URL) error {
-	if err := json.NewEncoder(s.writer).Encode(model); err != nil {
+// runCompaction выполняет уплотнение; s.compacting уже выставлен вызывающим
+func (s *FileStorage) runCompaction(ctx context.Context) error {
+	s.mu.Lock()
+	s.pending = nil
+	snapshot := s.memory.snapshot()
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.compacting = false
+		s.pending = nil
+		s.mu.Unlock()
+	}()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".compact-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer := bufio.NewWriter(tmp)
+	for _, model := range snapshot {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := encodeRecord(fileRecord{Op: opCreate, URL: model})
+		if err != nil {
+			return fmt.Errorf("failed to encode snapshot: %w", err)
+		}
+		if _, err := writer.Write(line); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStorageClosed
+	}
+
+	// Дописываем то, что пришло в журнал, пока писался снимок
+	for _, line := range s.pending {
+		if _, err := writer.Write(line); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
 		return err
 	}
-	if err := s.writer.Flush(); err != nil {
+
+	// Новый журнал открывается до подмены: если это не удалось, продолжаем
+	// писать в старый файл, а не в отвязанный от каталога inode
+	file, err := replaceLog(tmp.Name(), s.path, os.O_RDWR)
+	if err != nil {
 		return err
 	}
+	s.file.Close()
+
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	s.records = len(snapshot) + len(s.pending)
+	s.size = info.Size()
+	s.baseSize = s.size
 
-	return s.memory.SaveShortURL(ctx, model)
+	if err := syncDir(filepath.Dir(s.path)); err != nil {
+		return fmt.Errorf("failed to sync log directory: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStorage) GetLongURL(ctx context.Context, short string) (string, error) {
+	return s.memory.GetLongURL(ctx, short)
 }
 
+func (s *FileStorage) Stats(ctx context.Context) (models.Stats, error) {
+	return s.memory.Stats(ctx)
+}
+
+func (s *FileStorage) GetURLInfo(ctx context.Context, short string) (*models.URL, error) {
+	return s.memory.GetURLInfo(ctx, short)
+}
+
+func (s *FileStorage) SaveShortURL(ctx context.Context, model models.URL) error {
+	return s.appendRecords([]fileRecord{{Op: opCreate, URL: model}}, func() {
+		s.memory.SaveShortURL(ctx, model)
+	})
+}
+
+// Close останавливает писателя, сбрасывает журнал на диск и снимает блокировку
 func (s *FileStorage) Close() error {
-	return s.file.Close()
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.close()
+	})
+	return err
 }
 
-func (s *FileStorage) SaveManyURLS(ctx context.Context, models []models.URL) error {
-	for _, model := range models {
-		if err := json.NewEncoder(s.writer).Encode(model); err != nil {
-			return err
-		}
+func (s *FileStorage) close() error {
+	close(s.stop)
+	<-s.writerDone
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+
+	err := s.writer.Flush()
+	if err == nil && s.opts.Sync != SyncNone {
+		err = s.file.Sync()
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
 	}
+	if unlockErr := unlockFile(s.lock); err == nil {
+		err = unlockErr
+	}
+	return err
+}
 
-	if err := s.writer.Flush(); err != nil {
-		return err
+func (s *FileStorage) SaveManyURLS(ctx context.Context, models []models.URL) error {
+	records := make([]fileRecord, len(models))
+	for i, model := range models {
+		records[i] = fileRecord{Op: opCreate, URL: model}
 	}
 
-	return s.memory.SaveManyURLS(ctx, models)
+	return s.appendRecords(records, func() {
+		s.memory.SaveManyURLS(ctx, models)
+	})
 }
 
 func (s *FileStorage) GetAll(ctx context.Context, userID string) ([]models.URL, error) {
 	return s.memory.GetAll(ctx, userID)
 }
 
+// MarkExpired записывает tombstone-записи для ссылок с истёкшим сроком действия
+func (s *FileStorage) MarkExpired(ctx context.Context, now time.Time) (int, error) {
+	expired := s.memory.expiredURLs(now)
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	records := make([]fileRecord, len(expired))
+	shortURLs := make([]string, len(expired))
+	for i, model := range expired {
+		records[i] = fileRecord{Op: opDelete, URL: models.URL{UserID: model.UserID, ShortURL: model.ShortURL}}
+		shortURLs[i] = model.ShortURL
+	}
+
+	err := s.appendRecords(records, func() {
+		s.memory.markDeleted(shortURLs)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+// DeleteURLs записывает в журнал tombstone-записи для ссылок пользователя,
+// чтобы удаление пережило перезапуск
 func (s *FileStorage) DeleteURLs(ctx context.Context, userID string, shortURLs []string) error {
-	return s.memory.DeleteURLs(ctx, userID, shortURLs)
+	owned := s.memory.ownedURLs(userID, shortURLs)
+	if len(owned) == 0 {
+		return nil
+	}
+
+	records := make([]fileRecord, len(owned))
+	for i, shortURL := range owned {
+		records[i] = fileRecord{Op: opDelete, URL: models.URL{UserID: userID, ShortURL: shortURL}}
+	}
+
+	return s.appendRecords(records, func() {
+		s.memory.DeleteURLs(ctx, userID, owned)
+	})
+}
+
+// DeleteURLsBatch записывает tombstone-записи всех пользователей одной группой
+func (s *FileStorage) DeleteURLsBatch(ctx context.Context, deletions []models.Deletion) error {
+	var records []fileRecord
+	var shortURLs []string
+	for _, deletion := range deletions {
+		for _, shortURL := range s.memory.ownedURLs(deletion.UserID, deletion.ShortURLs) {
+			records = append(records, fileRecord{Op: opDelete, URL: models.URL{UserID: deletion.UserID, ShortURL: shortURL}})
+			shortURLs = append(shortURLs, shortURL)
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	return s.appendRecords(records, func() {
+		s.memory.markDeleted(shortURLs)
+	})
 }
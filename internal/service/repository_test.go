@@ -0,0 +1,289 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linarium/shortener/internal/models"
+)
+
+func TestFileStorageReplaysDeletes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortener.json")
+
+	storage, err := NewFileStorage(path, FileStorageOptions{})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	urls := []models.URL{
+		{ID: "1", UserID: "owner", ShortURL: "aaa", OriginalURL: "http://a.com"},
+		{ID: "2", UserID: "owner", ShortURL: "bbb", OriginalURL: "http://b.com"},
+		{ID: "3", UserID: "other", ShortURL: "ccc", OriginalURL: "http://c.com"},
+	}
+	if err := storage.SaveManyURLS(ctx, urls); err != nil {
+		t.Fatalf("failed to save URLs: %v", err)
+	}
+	taken := models.URL{ID: "4", UserID: "other", ShortURL: "bbb", OriginalURL: "http://d.com"}
+	if err := storage.SaveShortURL(ctx, taken); !errors.Is(err, ErrShortURLExists) {
+		t.Errorf("expected ErrShortURLExists for taken key, got %v", err)
+	}
+	if err := storage.DeleteURLs(ctx, "owner", []string{"aaa", "ccc"}); err != nil {
+		t.Fatalf("failed to delete URLs: %v", err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("failed to close storage: %v", err)
+	}
+
+	storage, err = NewFileStorage(path, FileStorageOptions{})
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer storage.Close()
+
+	if _, err := storage.GetLongURL(ctx, "aaa"); !errors.Is(err, ErrGone) {
+		t.Errorf("expected aaa to stay deleted, got %v", err)
+	}
+	if long, err := storage.GetLongURL(ctx, "ccc"); err != nil || long != "http://c.com" {
+		t.Errorf("expected ccc of another user to survive, got %q, %v", long, err)
+	}
+
+	owned, err := storage.GetAll(ctx, "owner")
+	if err != nil {
+		t.Fatalf("failed to get URLs: %v", err)
+	}
+	if len(owned) != 1 || owned[0].ShortURL != "bbb" || owned[0].UserID != "owner" {
+		t.Errorf("expected only bbb for owner, got %v", owned)
+	}
+
+	if stats, _ := storage.Stats(ctx); stats.URLs != 2 || stats.Users != 2 {
+		t.Errorf("expected 2 urls of 2 users after replay, got %+v", stats)
+	}
+	if err := storage.DeleteURLs(ctx, "owner", []string{"bbb"}); err != nil {
+		t.Fatalf("failed to delete URLs: %v", err)
+	}
+	if stats, _ := storage.Stats(ctx); stats.URLs != 1 || stats.Users != 1 {
+		t.Errorf("expected 1 url of 1 user after deleting the last owned link, got %+v", stats)
+	}
+}
+
+func TestFileStorageCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortener.json")
+
+	storage, err := NewFileStorage(path, FileStorageOptions{})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	urls := []models.URL{
+		{ID: "1", UserID: "owner", ShortURL: "aaa", OriginalURL: "http://a.com"},
+		{ID: "2", UserID: "owner", ShortURL: "bbb", OriginalURL: "http://b.com"},
+	}
+	if err := storage.SaveManyURLS(ctx, urls); err != nil {
+		t.Fatalf("failed to save URLs: %v", err)
+	}
+	if err := storage.DeleteURLs(ctx, "owner", []string{"aaa"}); err != nil {
+		t.Fatalf("failed to delete URLs: %v", err)
+	}
+
+	if err := storage.Compact(ctx); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+
+	// Запись после уплотнения должна попасть в новый файл
+	if err := storage.SaveShortURL(ctx, models.URL{ID: "3", UserID: "owner", ShortURL: "ccc", OriginalURL: "http://c.com"}); err != nil {
+		t.Fatalf("failed to save URL: %v", err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("failed to close storage: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if lines := bytes.Count(content, []byte("\n")); lines != 3 {
+		t.Errorf("expected 3 records after compaction, got %d", lines)
+	}
+
+	storage, err = NewFileStorage(path, FileStorageOptions{})
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer storage.Close()
+
+	if _, err := storage.GetLongURL(ctx, "aaa"); !errors.Is(err, ErrGone) {
+		t.Errorf("expected aaa to stay deleted after compaction, got %v", err)
+	}
+	owned, _ := storage.GetAll(ctx, "owner")
+	if len(owned) != 2 {
+		t.Errorf("expected 2 live URLs for owner, got %v", owned)
+	}
+}
+
+func TestFileStorageAutoCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortener.json")
+
+	storage, err := NewFileStorage(path, FileStorageOptions{CompactRecords: 1})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	if err := storage.SaveShortURL(ctx, models.URL{ID: "1", UserID: "owner", ShortURL: "aaa", OriginalURL: "http://a.com"}); err != nil {
+		t.Fatalf("failed to save URL: %v", err)
+	}
+	if err := storage.DeleteURLs(ctx, "owner", []string{"aaa"}); err != nil {
+		t.Fatalf("failed to delete URLs: %v", err)
+	}
+
+	// Уплотнение запускается в фоне
+	for i := 0; i < 100; i++ {
+		storage.mu.Lock()
+		records, compacting := storage.records, storage.compacting
+		storage.mu.Unlock()
+		if records == 1 && !compacting {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expected background compaction to shrink the log")
+}
+
+func TestFileStorageConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortener.json")
+
+	storage, err := NewFileStorage(path, FileStorageOptions{Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	const writers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			model := models.URL{
+				ID:          fmt.Sprint(i),
+				UserID:      "owner",
+				ShortURL:    fmt.Sprintf("key%d", i),
+				OriginalURL: fmt.Sprintf("http://example%d.com", i),
+			}
+			if err := storage.SaveShortURL(ctx, model); err != nil {
+				t.Errorf("failed to save URL: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("failed to close storage: %v", err)
+	}
+	if err := storage.SaveShortURL(ctx, models.URL{ShortURL: "late"}); !errors.Is(err, ErrStorageClosed) {
+		t.Errorf("expected ErrStorageClosed after Close, got %v", err)
+	}
+
+	// Строгая загрузка упадёт, если строки журнала перемешались
+	storage, err = NewFileStorage(path, FileStorageOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer storage.Close()
+
+	if count := storage.memory.count(); count != writers {
+		t.Errorf("expected %d records, got %d", writers, count)
+	}
+}
+
+func TestFileStorageLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shortener.json")
+
+	storage, err := NewFileStorage(path, FileStorageOptions{})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	if _, err := NewFileStorage(path, FileStorageOptions{}); !errors.Is(err, ErrStorageLocked) {
+		t.Errorf("expected ErrStorageLocked for second open, got %v", err)
+	}
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("failed to close storage: %v", err)
+	}
+
+	storage, err = NewFileStorage(path, FileStorageOptions{})
+	if err != nil {
+		t.Fatalf("expected lock to be released after Close: %v", err)
+	}
+	storage.Close()
+}
+
+func TestFileStorageMarkExpired(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortener.json")
+
+	storage, err := NewFileStorage(path, FileStorageOptions{})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	urls := []models.URL{
+		{ID: "1", UserID: "owner", ShortURL: "old", OriginalURL: "http://old.com", ExpiresAt: &past},
+		{ID: "2", UserID: "owner", ShortURL: "new", OriginalURL: "http://new.com", ExpiresAt: &future},
+	}
+	if err := storage.SaveManyURLS(ctx, urls); err != nil {
+		t.Fatalf("failed to save URLs: %v", err)
+	}
+
+	marked, err := storage.MarkExpired(ctx, now)
+	if err != nil || marked != 1 {
+		t.Fatalf("expected 1 expired URL, got %d (%v)", marked, err)
+	}
+	storage.Close()
+
+	storage, err = NewFileStorage(path, FileStorageOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer storage.Close()
+
+	owned, _ := storage.GetAll(ctx, "owner")
+	if len(owned) != 1 || owned[0].ShortURL != "new" || owned[0].ExpiresAt == nil {
+		t.Errorf("expected only unexpired URL with expiry, got %v", owned)
+	}
+}
+
+func TestFindShortURLByOriginalSkipsDeleted(t *testing.T) {
+	ctx := context.Background()
+	storage, _ := NewMemoryStorage(ctx)
+
+	if err := storage.SaveShortURL(ctx, models.URL{ID: "1", UserID: "owner", ShortURL: "old", OriginalURL: "http://a.com"}); err != nil {
+		t.Fatalf("failed to save URL: %v", err)
+	}
+	if err := storage.DeleteURLs(ctx, "owner", []string{"old"}); err != nil {
+		t.Fatalf("failed to delete URL: %v", err)
+	}
+	if _, err := storage.FindShortURLByOriginal(ctx, "http://a.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected deleted link to be ignored, got %v", err)
+	}
+
+	if err := storage.SaveShortURL(ctx, models.URL{ID: "2", UserID: "owner", ShortURL: "new", OriginalURL: "http://a.com"}); err != nil {
+		t.Fatalf("failed to save URL: %v", err)
+	}
+	if short, err := storage.FindShortURLByOriginal(ctx, "http://a.com"); err != nil || short != "new" {
+		t.Errorf("expected the live link, got %q, %v", short, err)
+	}
+}
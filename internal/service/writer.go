@@ -0,0 +1,211 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/linarium/shortener/internal/logger"
+)
+
+// SyncPolicy определяет, когда журнал FileStorage сбрасывается на диск через fsync
+type SyncPolicy string
+
+const (
+	// SyncAlways — fsync после каждой групповой записи
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval — fsync не чаще одного раза за FileStorageOptions.SyncInterval
+	SyncInterval SyncPolicy = "interval"
+	// SyncNone — сброс на диск остаётся на усмотрение ОС
+	SyncNone SyncPolicy = "none"
+)
+
+// defaultSyncInterval используется, если для SyncInterval не задан период
+const defaultSyncInterval = time.Second
+
+// maxCommitBatch ограничивает число запросов, объединяемых в одну запись
+const maxCommitBatch = 256
+
+func ParseSyncPolicy(value string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(value); policy {
+	case SyncAlways, SyncInterval, SyncNone:
+		return policy, nil
+	case "":
+		return SyncInterval, nil
+	default:
+		return "", fmt.Errorf("unknown sync policy %q", value)
+	}
+}
+
+// appendRequest — запрос на дозапись в журнал, ожидающий групповой фиксации.
+// keys — создаваемые короткие ссылки, их уникальность проверяется при фиксации.
+type appendRequest struct {
+	lines [][]byte
+	keys  []string
+	apply func()
+	done  chan error
+}
+
+// appendRecords ставит записи в очередь писателя и ждёт их фиксации.
+// После записи в журнал apply применяет изменения к памяти под той же
+// блокировкой, чтобы снимок для уплотнения не разошёлся с журналом.
+func (s *FileStorage) appendRecords(records []fileRecord, apply func()) error {
+	lines, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, record := range records {
+		if record.Op == opCreate {
+			keys = append(keys, record.ShortURL)
+		}
+	}
+
+	req := &appendRequest{lines: lines, keys: keys, apply: apply, done: make(chan error, 1)}
+	select {
+	case s.requests <- req:
+	case <-s.stop:
+		return ErrStorageClosed
+	}
+
+	return <-req.done
+}
+
+// runWriter — единственный писатель журнала. Он забирает все запросы,
+// накопившиеся к моменту записи, и фиксирует их одной группой.
+func (s *FileStorage) runWriter() {
+	defer close(s.writerDone)
+
+	var tick <-chan time.Time
+	if s.opts.Sync == SyncInterval {
+		interval := s.opts.SyncInterval
+		if interval <= 0 {
+			interval = defaultSyncInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case req := <-s.requests:
+			batch := []*appendRequest{req}
+		drain:
+			for len(batch) < maxCommitBatch {
+				select {
+				case req := <-s.requests:
+					batch = append(batch, req)
+				default:
+					break drain
+				}
+			}
+
+			s.commit(batch)
+		case <-tick:
+			s.syncIfDirty()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// commit записывает группу запросов в журнал одним сбросом буфера и
+// отвечает каждому запросу. Запросы с занятыми короткими ссылками
+// отклоняются по отдельности и в журнал не попадают.
+func (s *FileStorage) commit(batch []*appendRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accepted := make([]*appendRequest, 0, len(batch))
+	claimed := make(map[string]struct{})
+	for _, req := range batch {
+		if s.closed {
+			req.done <- ErrStorageClosed
+			continue
+		}
+		if err := s.claimKeys(req.keys, claimed); err != nil {
+			req.done <- err
+			continue
+		}
+		accepted = append(accepted, req)
+	}
+
+	err := s.writeBatch(accepted)
+	for _, req := range accepted {
+		if err == nil {
+			if s.compacting {
+				s.pending = append(s.pending, req.lines...)
+			}
+			req.apply()
+		}
+		req.done <- err
+	}
+
+	if err == nil && !s.compacting && s.needsCompaction() {
+		s.compacting = true
+		go s.compactInBackground()
+	}
+}
+
+// claimKeys проверяет, что ключи не заняты ни в хранилище, ни другими
+// запросами той же группы; вызывается под s.mu
+func (s *FileStorage) claimKeys(keys []string, claimed map[string]struct{}) error {
+	for i, key := range keys {
+		_, taken := claimed[key]
+		if taken || s.memory.exists(key) {
+			for _, claimedKey := range keys[:i] {
+				delete(claimed, claimedKey)
+			}
+			return fmt.Errorf("%w: %s", ErrShortURLExists, key)
+		}
+		claimed[key] = struct{}{}
+	}
+	return nil
+}
+
+// writeBatch вызывается под s.mu
+func (s *FileStorage) writeBatch(batch []*appendRequest) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	lines := 0
+	for _, req := range batch {
+		for _, line := range req.lines {
+			if _, err := s.writer.Write(line); err != nil {
+				return err
+			}
+			s.size += int64(len(line))
+		}
+		lines += len(req.lines)
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	s.records += lines
+	s.dirty = true
+
+	if s.opts.Sync == SyncAlways {
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync log: %w", err)
+		}
+		s.dirty = false
+	}
+
+	return nil
+}
+
+func (s *FileStorage) syncIfDirty() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || !s.dirty {
+		return
+	}
+	if err := s.file.Sync(); err != nil {
+		logger.Sugar.Errorf("Failed to sync %s: %v", s.path, err)
+		return
+	}
+	s.dirty = false
+}
@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ограничения на пользовательский алиас короткой ссылки
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+var (
+	// ErrInvalidAlias возвращается для алиаса, не прошедшего проверку
+	ErrInvalidAlias = errors.New("invalid alias")
+	// ErrAliasTaken возвращается, если алиас уже занят другой ссылкой
+	ErrAliasTaken = errors.New("alias is already taken")
+)
+
+// reservedAliases не дают алиасам перекрыть маршруты сервиса
+var reservedAliases = map[string]struct{}{
+	"api":      {},
+	"ping":     {},
+	"admin":    {},
+	"internal": {},
+	"metrics":  {},
+	"health":   {},
+	"static":   {},
+}
+
+// validateAlias проверяет длину, набор символов и зарезервированные слова
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: length must be between %d and %d characters", ErrInvalidAlias, minAliasLength, maxAliasLength)
+	}
+
+	for _, r := range alias {
+		if !isAliasRune(r) {
+			return fmt.Errorf("%w: only latin letters, digits, '-' and '_' are allowed", ErrInvalidAlias)
+		}
+	}
+
+	if _, reserved := reservedAliases[strings.ToLower(alias)]; reserved {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidAlias, alias)
+	}
+
+	return nil
+}
+
+func isAliasRune(r rune) bool {
+	return r >= 'a' && r <= 'z' ||
+		r >= 'A' && r <= 'Z' ||
+		r >= '0' && r <= '9' ||
+		r == '-' || r == '_'
+}
@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/linarium/shortener/internal/models"
+	"github.com/linarium/shortener/internal/service"
+)
+
+// Формат ключа доступа: apiKeyPrefix и случайная часть. Первые
+// apiKeyShownLength символов сохраняются открыто для опознания ключа.
+const (
+	apiKeyPrefix      = "shk_"
+	apiKeyShownLength = 12
+	maxAPIKeyName     = 100
+)
+
+var (
+	// ErrAPIKeyNotFound возвращается при отзыве чужого или несуществующего ключа
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidAPIKeyName возвращается для слишком длинного названия ключа
+	ErrInvalidAPIKeyName = errors.New("invalid API key name")
+)
+
+type APIKeys interface {
+	// CreateAPIKey создаёт ключ и возвращает его описание и сам ключ;
+	// ключ виден только в этот момент
+	CreateAPIKey(ctx context.Context, userID string, name string) (models.APIKey, string, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID string, id string) error
+	// ResolveAPIKey возвращает владельца ключа
+	ResolveAPIKey(ctx context.Context, key string) (string, bool, error)
+}
+
+type APIKeyService struct {
+	store service.APIKeyStore
+}
+
+func NewAPIKeyService(store service.APIKeyStore) APIKeys {
+	return &APIKeyService{store: store}
+}
+
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, userID string, name string) (models.APIKey, string, error) {
+	if userID == "" {
+		return models.APIKey{}, "", fmt.Errorf("userID is required")
+	}
+	if len(name) > maxAPIKeyName {
+		return models.APIKey{}, "", fmt.Errorf("%w: must be at most %d characters", ErrInvalidAPIKeyName, maxAPIKeyName)
+	}
+
+	secret := apiKeyPrefix + rand.Text()
+	key := models.APIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:apiKeyShownLength],
+		Hash:      hashAPIKey(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.store.SaveAPIKey(ctx, key); err != nil {
+		return models.APIKey{}, "", err
+	}
+
+	return key, secret, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("userID is required")
+	}
+	return s.store.ListAPIKeys(ctx, userID)
+}
+
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, userID string, id string) error {
+	revoked, err := s.store.RevokeAPIKey(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *APIKeyService) ResolveAPIKey(ctx context.Context, key string) (string, bool, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", false, nil
+	}
+
+	apiKey, found, err := s.store.FindAPIKeyByHash(ctx, hashAPIKey(key))
+	if err != nil || !found {
+		return "", false, err
+	}
+	return apiKey.UserID, true, nil
+}
+
+// hashAPIKey — ключи случайны и длинны, поэтому медленный хеш не нужен
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
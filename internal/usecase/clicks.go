@@ -0,0 +1,36 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/linarium/shortener/internal/models"
+)
+
+// recentClicksLimit — сколько последних переходов отдаётся в статистике
+const recentClicksLimit = 20
+
+// ErrNotOwner возвращается при обращении к чужой ссылке
+var ErrNotOwner = errors.New("url belongs to another user")
+
+func (s *ShortenerService) RecordClick(ctx context.Context, click models.Click) error {
+	return s.clicks.SaveClicks(ctx, []models.Click{click})
+}
+
+// GetClickStats отдаёт статистику переходов только владельцу ссылки
+func (s *ShortenerService) GetClickStats(ctx context.Context, userID string, shortURL string) (models.ClickStats, error) {
+	if userID == "" {
+		return models.ClickStats{}, fmt.Errorf("userID is required")
+	}
+
+	url, err := s.storage.GetURLInfo(ctx, shortURL)
+	if err != nil {
+		return models.ClickStats{}, err
+	}
+	if url.UserID != userID {
+		return models.ClickStats{}, ErrNotOwner
+	}
+
+	return s.clicks.GetClickStats(ctx, shortURL, recentClicksLimit)
+}
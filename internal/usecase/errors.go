@@ -0,0 +1,16 @@
+package usecase
+
+import "github.com/linarium/shortener/internal/service"
+
+// Ошибки исходов, общие для всех бэкендов хранилища. Обработчики переводят
+// их в коды ответа, не завися от пакета service.
+var (
+	// ErrConflict — URL уже сокращён
+	ErrConflict = service.ErrConflict
+	// ErrNotFound — короткой ссылки не существует
+	ErrNotFound = service.ErrNotFound
+	// ErrGone — ссылка удалена или истекла
+	ErrGone = service.ErrGone
+	// ErrUnavailable — хранилище временно недоступно
+	ErrUnavailable = service.ErrUnavailable
+)
@@ -0,0 +1,40 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidExpiry возвращается для некорректного срока действия ссылки
+var ErrInvalidExpiry = errors.New("invalid expiry")
+
+// ShortenOptions — необязательные параметры сокращения ссылки
+type ShortenOptions struct {
+	// Alias — выбранная пользователем короткая ссылка, пустая означает генерацию
+	Alias string
+	// ExpiresAt и TTL задают срок действия ссылки; допустимо только одно из них
+	ExpiresAt *time.Time
+	TTL       time.Duration
+}
+
+// resolveExpiry переводит срок действия из запроса в абсолютное время в UTC
+func resolveExpiry(expiresAt *time.Time, ttl time.Duration, now time.Time) (*time.Time, error) {
+	switch {
+	case expiresAt != nil && ttl != 0:
+		return nil, fmt.Errorf("%w: expires_at and ttl are mutually exclusive", ErrInvalidExpiry)
+	case ttl < 0:
+		return nil, fmt.Errorf("%w: ttl must be positive", ErrInvalidExpiry)
+	case ttl > 0:
+		at := now.Add(ttl).UTC()
+		return &at, nil
+	case expiresAt != nil:
+		if !expiresAt.After(now) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidExpiry)
+		}
+		at := expiresAt.UTC()
+		return &at, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidURL возвращается для URL, который нельзя сократить
+var ErrInvalidURL = errors.New("invalid URL")
+
+// defaultPorts — порты, которые не пишутся в каноническом URL
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// trackingParams — параметры отслеживания, не влияющие на содержимое страницы.
+// Все параметры с префиксом utm_ тоже считаются отслеживающими.
+var trackingParams = map[string]struct{}{
+	"fbclid":  {},
+	"gclid":   {},
+	"dclid":   {},
+	"msclkid": {},
+	"yclid":   {},
+	"igshid":  {},
+	"mc_cid":  {},
+	"mc_eid":  {},
+}
+
+// NormalizeURL проверяет, что raw — абсолютный http(s) URL, и приводит его к
+// каноническому виду: схема и хост в нижнем регистре, IDN в punycode, без
+// порта по умолчанию и фрагмента. При stripTracking из запроса удаляются
+// параметры отслеживания.
+func NormalizeURL(raw string, stripTracking bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%w: URL is empty", ErrInvalidURL)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed URL", ErrInvalidURL)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return "", fmt.Errorf("%w: only http and https URLs are allowed", ErrInvalidURL)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", fmt.Errorf("%w: URL must have a host", ErrInvalidURL)
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("%w: bad port %q", ErrInvalidURL, port)
+		}
+	}
+	if port == "" || port == defaultPorts[u.Scheme] {
+		// Квадратные скобки IPv6 нужны и без порта
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		u.Host = host
+	} else {
+		u.Host = net.JoinHostPort(host, port)
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	if stripTracking {
+		u.RawQuery = stripTrackingParams(u.RawQuery)
+	}
+	u.ForceQuery = u.ForceQuery && u.RawQuery != ""
+
+	return u.String(), nil
+}
+
+// normalizeHost переводит имя хоста в нижний регистр и punycode
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("%w: URL must have a host", ErrInvalidURL)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return strings.ToLower(host), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad host name %q", ErrInvalidURL, host)
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// stripTrackingParams удаляет параметры отслеживания, сохраняя порядок и
+// кодирование остальных
+func stripTrackingParams(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		name, _, _ := strings.Cut(part, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		name = strings.ToLower(name)
+		if _, tracking := trackingParams[name]; tracking || strings.HasPrefix(name, "utm_") {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, "&")
+}
@@ -0,0 +1,55 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		stripTracking bool
+		want          string
+		wantErr       bool
+	}{
+		{name: "lowercases scheme and host", raw: "HTTPS://Example.COM/Path", want: "https://example.com/Path"},
+		{name: "strips default port", raw: "http://example.com:80/a", want: "http://example.com/a"},
+		{name: "keeps custom port", raw: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "drops fragment", raw: "https://example.com/a#section", want: "https://example.com/a"},
+		{name: "converts IDN to punycode", raw: "http://пример.рф/", want: "http://xn--e1afmkfd.xn--p1ai/"},
+		{name: "keeps IPv6 host", raw: "http://[::1]:80/", want: "http://[::1]/"},
+		{name: "keeps tracking params by default", raw: "https://example.com/?utm_source=x", want: "https://example.com/?utm_source=x"},
+		{
+			name:          "strips tracking params",
+			raw:           "https://example.com/?b=2&utm_source=x&fbclid=y&a=1",
+			stripTracking: true,
+			want:          "https://example.com/?b=2&a=1",
+		},
+		{name: "strips only tracking params", raw: "https://example.com/?utm_medium=x", stripTracking: true, want: "https://example.com/"},
+		{name: "rejects empty", raw: "  ", wantErr: true},
+		{name: "rejects javascript", raw: "javascript:alert(1)", wantErr: true},
+		{name: "rejects ftp", raw: "ftp://example.com/file", wantErr: true},
+		{name: "rejects plain text", raw: "just some text", wantErr: true},
+		{name: "rejects missing host", raw: "http:///path", wantErr: true},
+		{name: "rejects bad port", raw: "http://example.com:99999/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeURL(tt.raw, tt.stripTracking)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidURL) {
+					t.Fatalf("expected ErrInvalidURL, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,73 +2,178 @@ package usecase
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/linarium/shortener/internal/keygen"
 	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/metrics"
 	"github.com/linarium/shortener/internal/models"
 	"github.com/linarium/shortener/internal/service"
 	"strings"
+	"time"
 )
 
 type Repository interface {
-	Shorten(ctx context.Context, url string, userID string) (string, bool)
+	Shorten(ctx context.Context, url string, userID string) (string, error)
+	ShortenWithOptions(ctx context.Context, url string, userID string, opts ShortenOptions) (string, error)
 	ShortenBatch(ctx context.Context, longs models.BatchRequest, baseURL string, userID string) (models.BatchResponse, error)
-	Expand(ctx context.Context, shortURL string) (string, bool, bool)
+	Expand(ctx context.Context, shortURL string) (string, error)
 	Ping(ctx context.Context) error
 	GetUserURLs(ctx context.Context, userID string) ([]models.URL, error)
 	DeleteURLs(ctx context.Context, userID string, shortURLs []string) error
+	Compact(ctx context.Context) error
+	RecordClick(ctx context.Context, click models.Click) error
+	GetClickStats(ctx context.Context, userID string, shortURL string) (models.ClickStats, error)
+	DeletionStats() service.DeletionStats
+	Stats(ctx context.Context) (models.Stats, error)
+	CheckDestination(url string) error
 }
 
+// Policy решает, разрешён ли адрес назначения; ошибка содержит причину запрета
+type Policy interface {
+	Check(url string) error
+}
+
+// ErrURLBlocked возвращается для адреса, запрещённого политикой
+var ErrURLBlocked = errors.New("URL is blocked by policy")
+
+// ShortenerOptions — настройки сервиса сокращения ссылок
+type ShortenerOptions struct {
+	// StripTrackingParams удаляет из URL параметры отслеживания вроде utm_*
+	StripTrackingParams bool
+	// Policy проверяет адреса при сокращении и переходе; nil разрешает всё
+	Policy Policy
+	// Keys генерирует короткие ключи; nil — 8 символов base64url
+	Keys *keygen.Generator
+	// KeyAttempts — сколько ключей пробовать, если сгенерированный уже занят
+	KeyAttempts int
+}
+
+// defaultKeyAttempts — значение ShortenerOptions.KeyAttempts по умолчанию
+const defaultKeyAttempts = 5
+
+// ErrNoFreeKey возвращается, если все попытки сгенерировать ключ дали занятые ключи
+var ErrNoFreeKey = errors.New("no free short key found")
+
 type ShortenerService struct {
-	storage service.Storage
+	storage   service.Storage
+	clicks    service.ClickStore
+	deletions *service.DeletionQueue
+	opts      ShortenerOptions
 }
 
-func NewShortenerService(storage service.Storage) Repository {
-	return &ShortenerService{storage: storage}
+// NewShortenerService создаёт сервис сокращения ссылок. Если deletions равен nil,
+// DeleteURLs удаляет ссылки синхронно, иначе только ставит удаление в очередь.
+func NewShortenerService(storage service.Storage, clicks service.ClickStore, deletions *service.DeletionQueue, opts ShortenerOptions) Repository {
+	if opts.Keys == nil {
+		opts.Keys = keygen.Default()
+	}
+	if opts.KeyAttempts <= 0 {
+		opts.KeyAttempts = defaultKeyAttempts
+	}
+	return &ShortenerService{storage: storage, clicks: clicks, deletions: deletions, opts: opts}
 }
 
+// generateShortKey создаёт ключ, не совпадающий с зарезервированными словами
 func (s *ShortenerService) generateShortKey() string {
-	b := make([]byte, 6)
-	_, err := rand.Read(b)
-	if err != nil {
-		logger.Sugar.Fatalf("Ошибка при генерации сокращённого URL: %v", err)
+	for {
+		key := s.opts.Keys.Generate()
+		if _, reserved := reservedAliases[strings.ToLower(key)]; !reserved {
+			return key
+		}
 	}
-	return base64.URLEncoding.EncodeToString(b)[:8]
 }
 
-func (s *ShortenerService) Shorten(ctx context.Context, longURL string, userID string) (string, bool) {
-	shortKey := s.generateShortKey()
+// keyCollision учитывает совпадение сгенерированного ключа с занятым. Частые
+// совпадения означают, что ключи пора удлинить.
+func (s *ShortenerService) keyCollision(ctx context.Context, key string) {
+	metrics.KeyCollisions.Inc()
+	logger.FromContext(ctx).Warnf("Generated short key %s is already taken, consider increasing the key length", key)
+}
+
+// Shorten сокращает URL без дополнительных параметров
+func (s *ShortenerService) Shorten(ctx context.Context, longURL string, userID string) (string, error) {
+	return s.ShortenWithOptions(ctx, longURL, userID, ShortenOptions{})
+}
+
+// ShortenWithOptions сокращает URL с необязательными алиасом и сроком действия.
+// Если URL уже сокращён, возвращается существующая короткая ссылка вместе с
+// ошибкой ErrConflict.
+func (s *ShortenerService) ShortenWithOptions(ctx context.Context, longURL string, userID string, opts ShortenOptions) (string, error) {
+	longURL, err := NormalizeURL(longURL, s.opts.StripTrackingParams)
+	if err != nil {
+		return "", err
+	}
+	if err := s.CheckDestination(longURL); err != nil {
+		return "", err
+	}
+
+	alias := opts.Alias
+	shortKey := alias
+	if alias == "" {
+		shortKey = s.generateShortKey()
+	} else if err := validateAlias(alias); err != nil {
+		return "", err
+	}
+
+	expiresAt, err := resolveExpiry(opts.ExpiresAt, opts.TTL, time.Now())
+	if err != nil {
+		return "", err
+	}
+
 	model := models.URL{
 		ID:          uuid.New().String(),
 		ShortURL:    shortKey,
 		OriginalURL: longURL,
 		UserID:      userID,
+		ExpiresAt:   expiresAt,
 	}
 
-	err := s.storage.SaveShortURL(ctx, model)
-	if err != nil {
-		if strings.HasPrefix(err.Error(), "duplicate_original:") {
-			if existingShort, ok := s.findShortKeyByOriginalURL(ctx, longURL); ok {
-				return existingShort, true
-			}
+	err = s.storage.SaveShortURL(ctx, model)
+	// Занятый сгенерированный ключ — не конфликт с данными клиента,
+	// поэтому пробуем другой
+	for attempt := 1; alias == "" && errors.Is(err, service.ErrShortURLExists); attempt++ {
+		s.keyCollision(ctx, model.ShortURL)
+		if attempt >= s.opts.KeyAttempts {
+			return "", fmt.Errorf("%w after %d attempts", ErrNoFreeKey, attempt)
 		}
+		model.ShortURL = s.generateShortKey()
+		err = s.storage.SaveShortURL(ctx, model)
 	}
 
-	return shortKey, false
+	var duplicate *service.DuplicateURLError
+	switch {
+	case err == nil:
+		return model.ShortURL, nil
+	case errors.As(err, &duplicate):
+		return duplicate.ShortURL, fmt.Errorf("%w: %v", ErrConflict, err)
+	case errors.Is(err, service.ErrShortURLExists):
+		return "", ErrAliasTaken
+	default:
+		return "", fmt.Errorf("failed to save URL: %w", err)
+	}
 }
 
-func (s *ShortenerService) Expand(ctx context.Context, shortURL string) (string, bool, bool) {
+// Expand возвращает оригинальный URL или ErrNotFound, ErrGone, ErrUnavailable
+func (s *ShortenerService) Expand(ctx context.Context, shortURL string) (string, error) {
 	return s.storage.GetLongURL(ctx, shortURL)
 }
 
-func (s *ShortenerService) Ping(ctx context.Context) error {
-	return s.storage.Ping(ctx)
+// CheckDestination проверяет адрес по политике. Вызывается и при переходе,
+// чтобы ссылки на заблокированные позже адреса перестали работать.
+func (s *ShortenerService) CheckDestination(url string) error {
+	if s.opts.Policy == nil {
+		return nil
+	}
+	if err := s.opts.Policy.Check(url); err != nil {
+		return fmt.Errorf("%w: %v", ErrURLBlocked, err)
+	}
+	return nil
 }
 
-func (s *ShortenerService) findShortKeyByOriginalURL(ctx context.Context, original string) (string, bool) {
-	return s.storage.FindShortURLByOriginal(ctx, original)
+func (s *ShortenerService) Ping(ctx context.Context) error {
+	return s.storage.Ping(ctx)
 }
 
 func (s *ShortenerService) ShortenBatch(ctx context.Context, longs models.BatchRequest, baseURL string, userID string) (models.BatchResponse, error) {
@@ -76,13 +181,43 @@ func (s *ShortenerService) ShortenBatch(ctx context.Context, longs models.BatchR
 	shorts := make(models.BatchResponse, length)
 	urls := make([]models.URL, length)
 
+	now := time.Now()
+	aliases := make(map[string]struct{}, length)
+	var generated []int
 	for i, long := range longs {
-		shortKey := s.generateShortKey()
+		originalURL, err := NormalizeURL(long.OriginalURL, s.opts.StripTrackingParams)
+		if err != nil {
+			return nil, fmt.Errorf("%w (correlation_id %s)", err, long.CorrelationID)
+		}
+		if err := s.CheckDestination(originalURL); err != nil {
+			return nil, fmt.Errorf("%w (correlation_id %s)", err, long.CorrelationID)
+		}
+
+		expiresAt, err := resolveExpiry(long.ExpiresAt, time.Duration(long.TTL)*time.Second, now)
+		if err != nil {
+			return nil, err
+		}
+
+		shortKey := long.Alias
+		if shortKey == "" {
+			shortKey = s.generateShortKey()
+			generated = append(generated, i)
+		} else {
+			if err := validateAlias(shortKey); err != nil {
+				return nil, err
+			}
+			if _, seen := aliases[shortKey]; seen {
+				return nil, fmt.Errorf("%w: %s", ErrAliasTaken, shortKey)
+			}
+			aliases[shortKey] = struct{}{}
+		}
+
 		urls[i] = models.URL{
 			ID:          uuid.New().String(),
 			ShortURL:    shortKey,
-			OriginalURL: long.OriginalURL,
+			OriginalURL: originalURL,
 			UserID:      userID,
+			ExpiresAt:   expiresAt,
 		}
 		shorts[i] = models.BatchResponseItem{
 			CorrelationID: long.CorrelationID,
@@ -90,24 +225,53 @@ func (s *ShortenerService) ShortenBatch(ctx context.Context, longs models.BatchR
 		}
 	}
 
-	if batchStorage, ok := s.storage.(interface {
-		SaveManyURLS(ctx context.Context, urls []models.URL) error
-	}); ok {
-		err := batchStorage.SaveManyURLS(ctx, urls)
-		if err != nil {
+	for attempt := 1; ; attempt++ {
+		err := s.storage.SaveManyURLS(ctx, urls)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, service.ErrShortURLExists) {
 			return nil, fmt.Errorf("failed to save batch: %w", err)
 		}
-	} else {
-		for _, url := range urls {
-			if err := s.storage.SaveShortURL(ctx, url); err != nil {
-				return nil, fmt.Errorf("failed to save URL: %w", err)
-			}
+
+		// Хранилище не сообщает, какой ключ занят: если это не алиас
+		// клиента, значит, совпал один из сгенерированных
+		taken, err := s.anyAliasTaken(ctx, aliases)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check aliases: %w", err)
+		}
+		if taken || len(generated) == 0 {
+			return nil, ErrAliasTaken
+		}
+
+		s.keyCollision(ctx, "in batch")
+		if attempt >= s.opts.KeyAttempts {
+			return nil, fmt.Errorf("%w after %d attempts", ErrNoFreeKey, attempt)
+		}
+		for _, i := range generated {
+			shortKey := s.generateShortKey()
+			urls[i].ShortURL = shortKey
+			shorts[i].ShortURL = baseURL + "/" + shortKey
 		}
 	}
 
 	return shorts, nil
 }
 
+// anyAliasTaken сообщает, занят ли в хранилище хотя бы один из алиасов
+func (s *ShortenerService) anyAliasTaken(ctx context.Context, aliases map[string]struct{}) (bool, error) {
+	for alias := range aliases {
+		_, err := s.storage.GetURLInfo(ctx, alias)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, service.ErrNotFound) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
 func (s *ShortenerService) GetUserURLs(ctx context.Context, userID string) ([]models.URL, error) {
 	if userID == "" {
 		return nil, fmt.Errorf("userID is required")
@@ -124,5 +288,32 @@ func (s *ShortenerService) DeleteURLs(ctx context.Context, userID string, shortU
 		return nil
 	}
 
+	if s.deletions != nil {
+		return s.deletions.Enqueue(models.Deletion{
+			UserID:    userID,
+			ShortURLs: shortURLs,
+			RequestID: logger.RequestIDFromContext(ctx),
+		})
+	}
+
 	return s.storage.DeleteURLs(ctx, userID, shortURLs)
 }
+
+func (s *ShortenerService) Stats(ctx context.Context) (models.Stats, error) {
+	return s.storage.Stats(ctx)
+}
+
+func (s *ShortenerService) DeletionStats() service.DeletionStats {
+	if s.deletions == nil {
+		return service.DeletionStats{}
+	}
+	return s.deletions.Stats()
+}
+
+func (s *ShortenerService) Compact(ctx context.Context) error {
+	compactor, ok := s.storage.(service.Compactor)
+	if !ok {
+		return service.ErrCompactionNotSupported
+	}
+	return compactor.Compact(ctx)
+}
@@ -0,0 +1,88 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/linarium/shortener/internal/logger"
+	"github.com/linarium/shortener/internal/models"
+	"github.com/linarium/shortener/internal/service"
+)
+
+// collidingStorage отвечает ErrShortURLExists на первые collisions сохранений
+type collidingStorage struct {
+	service.Storage
+	collisions int
+	saved      []string
+}
+
+func (s *collidingStorage) SaveShortURL(ctx context.Context, model models.URL) error {
+	if len(s.saved) < s.collisions {
+		s.saved = append(s.saved, model.ShortURL)
+		return service.ErrShortURLExists
+	}
+	s.saved = append(s.saved, model.ShortURL)
+	return s.Storage.SaveShortURL(ctx, model)
+}
+
+func TestShortenRetriesKeyCollisions(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		collisions int
+		wantErr    error
+		wantSaves  int
+	}{
+		{name: "no collisions", collisions: 0, wantSaves: 1},
+		{name: "retries until free key", collisions: 2, wantSaves: 3},
+		{name: "gives up after attempts", collisions: 3, wantErr: ErrNoFreeKey, wantSaves: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory, err := service.NewMemoryStorage(ctx)
+			if err != nil {
+				t.Fatalf("failed to create storage: %v", err)
+			}
+			storage := &collidingStorage{Storage: memory, collisions: tt.collisions}
+			shortener := NewShortenerService(storage, nil, nil, ShortenerOptions{KeyAttempts: 3})
+
+			key, err := shortener.Shorten(ctx, "https://example.com/", "user")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if len(storage.saved) != tt.wantSaves {
+				t.Errorf("expected %d saves, got %d", tt.wantSaves, len(storage.saved))
+			}
+			if tt.wantErr == nil && key != storage.saved[len(storage.saved)-1] {
+				t.Errorf("expected the last tried key %q, got %q", storage.saved[len(storage.saved)-1], key)
+			}
+		})
+	}
+}
+
+func TestShortenBatchAliasTaken(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+
+	storage, err := service.NewMemoryStorage(ctx)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	shortener := NewShortenerService(storage, nil, nil, ShortenerOptions{})
+
+	if _, err := shortener.ShortenWithOptions(ctx, "https://a.example/", "user", ShortenOptions{Alias: "promo"}); err != nil {
+		t.Fatalf("failed to shorten: %v", err)
+	}
+
+	batch := models.BatchRequest{
+		{CorrelationID: "1", OriginalURL: "https://b.example/"},
+		{CorrelationID: "2", OriginalURL: "https://c.example/", Alias: "promo"},
+	}
+	if _, err := shortener.ShortenBatch(ctx, batch, "http://localhost", "user"); !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("expected ErrAliasTaken, got %v", err)
+	}
+}
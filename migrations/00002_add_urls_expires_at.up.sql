@@ -0,0 +1,4 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN expires_at timestamptz;
+
+CREATE INDEX idx_urls_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL AND is_deleted = FALSE;
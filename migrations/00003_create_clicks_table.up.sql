@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE clicks (
+    id bigserial PRIMARY KEY,
+    short_url varchar(100) NOT NULL,
+    clicked_at timestamptz NOT NULL DEFAULT now(),
+    referrer text,
+    user_agent text,
+    ip_hash varchar(64)
+);
+
+CREATE INDEX idx_clicks_short_url_clicked_at ON clicks(short_url, clicked_at DESC);
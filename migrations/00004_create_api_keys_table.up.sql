@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE api_keys (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL,
+    name varchar(100) NOT NULL DEFAULT '',
+    prefix varchar(16) NOT NULL,
+    key_hash char(64) NOT NULL UNIQUE,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
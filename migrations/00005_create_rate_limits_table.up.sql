@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE rate_limits (
+    key text PRIMARY KEY,
+    tokens double precision NOT NULL,
+    allowed boolean NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_rate_limits_updated_at ON rate_limits(updated_at);
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Уникален только действующий URL: удалённая или истёкшая ссылка не мешает
+-- сократить его заново. Индекс по пользователю опирался на deleted_at, который
+-- не заполняется, и покрывается новым индексом.
+ALTER TABLE urls DROP CONSTRAINT urls_original_url_key;
+DROP INDEX idx_urls_user_original;
+CREATE UNIQUE INDEX idx_urls_original_url_live ON urls(original_url) WHERE NOT is_deleted;